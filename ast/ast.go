@@ -9,6 +9,7 @@ import (
 type Node interface {
 	TokenLiteral() string
 	String() string
+	Pos() token.Position
 }
 
 type Statement interface {
@@ -32,6 +33,13 @@ func (p *Program) TokenLiteral() string {
 	return ""
 }
 
+func (p *Program) Pos() token.Position {
+	if len(p.Statements) > 0 {
+		return p.Statements[0].Pos()
+	}
+	return token.Position{}
+}
+
 func (p *Program) String() string {
 	var out bytes.Buffer
 	for _, s := range p.Statements {
@@ -50,6 +58,10 @@ func (v *VarStatement) TokenLiteral() string {
 	return v.Token.Literal
 }
 
+func (v *VarStatement) Pos() token.Position {
+	return v.Token.Pos
+}
+
 func (v *VarStatement) String() string {
 	var out bytes.Buffer
 
@@ -78,6 +90,10 @@ func (r *ReturnStatement) TokenLiteral() string {
 	return r.Token.Literal
 }
 
+func (r *ReturnStatement) Pos() token.Position {
+	return r.Token.Pos
+}
+
 func (r *ReturnStatement) String() string {
 	var out bytes.Buffer
 
@@ -104,6 +120,10 @@ func (e *ExpressionStatement) TokenLiteral() string {
 	return e.Token.Literal
 }
 
+func (e *ExpressionStatement) Pos() token.Position {
+	return e.Token.Pos
+}
+
 func (e *ExpressionStatement) String() string {
 	if e.Value != nil {
 		return e.Value.String()
@@ -125,6 +145,10 @@ func (b *BlockStatement) TokenLiteral() string {
 	return b.Token.Literal
 }
 
+func (b *BlockStatement) Pos() token.Position {
+	return b.Token.Pos
+}
+
 func (b *BlockStatement) String() string {
 	var out bytes.Buffer
 
@@ -143,12 +167,21 @@ func (b *BlockStatement) statementNode() {
 type Identifier struct {
 	Token token.Token
 	Value string
+	// Resolved is set by the resolver for local variables, which then live Depth
+	// environments out at index Slot. Globals are looked up by name.
+	Resolved bool
+	Depth    int
+	Slot     int
 }
 
 func (i Identifier) TokenLiteral() string {
 	return i.Token.Literal
 }
 
+func (i Identifier) Pos() token.Position {
+	return i.Token.Pos
+}
+
 func (i Identifier) String() string {
 	return i.Value
 }
@@ -172,6 +205,10 @@ func (i IntegerLiteral) TokenLiteral() string {
 	return i.Token.Literal
 }
 
+func (i IntegerLiteral) Pos() token.Position {
+	return i.Token.Pos
+}
+
 func (i IntegerLiteral) String() string {
 	return i.TokenLiteral()
 }
@@ -181,6 +218,28 @@ func (i IntegerLiteral) expressionNode() {
 	panic("implement me")
 }
 
+type FloatLiteral struct {
+	Token token.Token
+	Value float64
+}
+
+func (f *FloatLiteral) TokenLiteral() string {
+	return f.Token.Literal
+}
+
+func (f *FloatLiteral) Pos() token.Position {
+	return f.Token.Pos
+}
+
+func (f *FloatLiteral) String() string {
+	return f.TokenLiteral()
+}
+
+func (f *FloatLiteral) expressionNode() {
+	//TODO implement me
+	panic("implement me")
+}
+
 type StringLiteral struct {
 	Token token.Token
 	Value string
@@ -190,6 +249,10 @@ func (s *StringLiteral) TokenLiteral() string {
 	return s.Token.Literal
 }
 
+func (s *StringLiteral) Pos() token.Position {
+	return s.Token.Pos
+}
+
 func (s *StringLiteral) String() string {
 	return s.Token.Literal
 }
@@ -209,6 +272,10 @@ func (p PrefixExpression) TokenLiteral() string {
 	return p.Token.Literal
 }
 
+func (p PrefixExpression) Pos() token.Position {
+	return p.Token.Pos
+}
+
 func (p PrefixExpression) String() string {
 	var out bytes.Buffer
 
@@ -236,6 +303,10 @@ func (i InfixExpression) TokenLiteral() string {
 	return i.Token.Literal
 }
 
+func (i InfixExpression) Pos() token.Position {
+	return i.Token.Pos
+}
+
 func (i InfixExpression) String() string {
 	var out bytes.Buffer
 
@@ -264,6 +335,10 @@ func (b *Boolean) TokenLiteral() string {
 	return b.Token.Literal
 }
 
+func (b *Boolean) Pos() token.Position {
+	return b.Token.Pos
+}
+
 func (b *Boolean) String() string {
 	return b.TokenLiteral()
 }
@@ -284,6 +359,10 @@ func (i *IfExpression) TokenLiteral() string {
 	return i.Token.Literal
 }
 
+func (i *IfExpression) Pos() token.Position {
+	return i.Token.Pos
+}
+
 func (i *IfExpression) String() string {
 	var out bytes.Buffer
 
@@ -307,30 +386,53 @@ func (i *IfExpression) expressionNode() {
 type FunctionLiteral struct {
 	Token      token.Token
 	Parameters []*Identifier
-	Body       *BlockStatement
+	// Defaults lines up with Parameters, nil for parameters without a default value
+	Defaults []Expression
+	// Rest collects the extra arguments of a variadic function
+	Rest *Identifier
+	Body *BlockStatement
+	// Name is the declared name, or the variable an anonymous function was bound to
+	Name string
+	// Slots is how many local variables the resolver found in the function
+	Slots int
 }
 
 func (f *FunctionLiteral) TokenLiteral() string {
 	return f.Token.Literal
 }
 
+func (f *FunctionLiteral) Pos() token.Position {
+	return f.Token.Pos
+}
+
 func (f *FunctionLiteral) String() string {
 	var out bytes.Buffer
 
-	params := []string{}
-	for _, p := range f.Parameters {
-		params = append(params, p.String())
-	}
-
 	out.WriteString(f.TokenLiteral())
 	out.WriteString("(")
-	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(ParameterList(f.Parameters, f.Defaults, f.Rest))
 	out.WriteString(") ")
 	out.WriteString(f.Body.String())
 
 	return out.String()
 }
 
+// ParameterList formats parameters the way they are written, e.g. `a, b = 10, ...rest`.
+func ParameterList(parameters []*Identifier, defaults []Expression, rest *Identifier) string {
+	params := []string{}
+	for i, p := range parameters {
+		if i < len(defaults) && defaults[i] != nil {
+			params = append(params, p.String()+" = "+defaults[i].String())
+		} else {
+			params = append(params, p.String())
+		}
+	}
+	if rest != nil {
+		params = append(params, "..."+rest.String())
+	}
+	return strings.Join(params, ", ")
+}
+
 func (f *FunctionLiteral) expressionNode() {
 	// TODO implement me
 	panic("implement me")
@@ -346,6 +448,10 @@ func (c *CallExpression) TokenLiteral() string {
 	return c.Token.Literal
 }
 
+func (c *CallExpression) Pos() token.Position {
+	return c.Token.Pos
+}
+
 func (c *CallExpression) String() string {
 	var out bytes.Buffer
 
@@ -376,6 +482,10 @@ func (a *ArrayLiteral) TokenLiteral() string {
 	return a.Token.Literal
 }
 
+func (a *ArrayLiteral) Pos() token.Position {
+	return a.Token.Pos
+}
+
 func (a *ArrayLiteral) String() string {
 	var out bytes.Buffer
 
@@ -406,6 +516,10 @@ func (i *IndexExpression) TokenLiteral() string {
 	return i.Token.Literal
 }
 
+func (i *IndexExpression) Pos() token.Position {
+	return i.Token.Pos
+}
+
 func (i *IndexExpression) String() string {
 	var out bytes.Buffer
 
@@ -422,3 +536,354 @@ func (i *IndexExpression) expressionNode() {
 	//TODO implement me
 	panic("implement me")
 }
+
+type HashPair struct {
+	Key   Expression
+	Value Expression
+}
+
+// HashLiteral keeps its pairs in source order so evaluation order is predictable.
+type HashLiteral struct {
+	Token token.Token
+	Pairs []HashPair
+}
+
+func (h *HashLiteral) TokenLiteral() string {
+	return h.Token.Literal
+}
+
+func (h *HashLiteral) Pos() token.Position {
+	return h.Token.Pos
+}
+
+func (h *HashLiteral) String() string {
+	var out bytes.Buffer
+
+	pairs := []string{}
+	for _, pair := range h.Pairs {
+		pairs = append(pairs, pair.Key.String()+": "+pair.Value.String())
+	}
+
+	out.WriteString("{")
+	out.WriteString(strings.Join(pairs, ", "))
+	out.WriteString("}")
+
+	return out.String()
+}
+
+func (h *HashLiteral) expressionNode() {
+	//TODO implement me
+	panic("implement me")
+}
+
+type WhileStatement struct {
+	Token     token.Token
+	Condition Expression
+	Body      *BlockStatement
+}
+
+func (w *WhileStatement) TokenLiteral() string {
+	return w.Token.Literal
+}
+
+func (w *WhileStatement) Pos() token.Position {
+	return w.Token.Pos
+}
+
+func (w *WhileStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("while ")
+	out.WriteString(w.Condition.String())
+	out.WriteString(" ")
+	out.WriteString(w.Body.String())
+
+	return out.String()
+}
+
+func (w *WhileStatement) statementNode() {
+	//TODO implement me
+	panic("implement me")
+}
+
+// ForStatement is the C-style `for (init; condition; step) { }` loop, every clause is optional.
+type ForStatement struct {
+	Token     token.Token
+	Init      Statement
+	Condition Expression
+	Step      Expression
+	Body      *BlockStatement
+}
+
+func (f *ForStatement) TokenLiteral() string {
+	return f.Token.Literal
+}
+
+func (f *ForStatement) Pos() token.Position {
+	return f.Token.Pos
+}
+
+func (f *ForStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("for (")
+	if f.Init != nil {
+		out.WriteString(strings.TrimSuffix(f.Init.String(), ";"))
+	}
+	out.WriteString("; ")
+	if f.Condition != nil {
+		out.WriteString(f.Condition.String())
+	}
+	out.WriteString("; ")
+	if f.Step != nil {
+		out.WriteString(f.Step.String())
+	}
+	out.WriteString(") ")
+	out.WriteString(f.Body.String())
+
+	return out.String()
+}
+
+func (f *ForStatement) statementNode() {
+	//TODO implement me
+	panic("implement me")
+}
+
+type ForInStatement struct {
+	Token    token.Token
+	Variable *Identifier
+	Iterable Expression
+	Body     *BlockStatement
+}
+
+func (f *ForInStatement) TokenLiteral() string {
+	return f.Token.Literal
+}
+
+func (f *ForInStatement) Pos() token.Position {
+	return f.Token.Pos
+}
+
+func (f *ForInStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("for (")
+	out.WriteString(f.Variable.String())
+	out.WriteString(" in ")
+	out.WriteString(f.Iterable.String())
+	out.WriteString(") ")
+	out.WriteString(f.Body.String())
+
+	return out.String()
+}
+
+func (f *ForInStatement) statementNode() {
+	//TODO implement me
+	panic("implement me")
+}
+
+type BreakStatement struct {
+	Token token.Token
+}
+
+func (b *BreakStatement) TokenLiteral() string {
+	return b.Token.Literal
+}
+
+func (b *BreakStatement) Pos() token.Position {
+	return b.Token.Pos
+}
+
+func (b *BreakStatement) String() string {
+	return b.TokenLiteral() + ";"
+}
+
+func (b *BreakStatement) statementNode() {
+	//TODO implement me
+	panic("implement me")
+}
+
+type ContinueStatement struct {
+	Token token.Token
+}
+
+func (c *ContinueStatement) TokenLiteral() string {
+	return c.Token.Literal
+}
+
+func (c *ContinueStatement) Pos() token.Position {
+	return c.Token.Pos
+}
+
+func (c *ContinueStatement) String() string {
+	return c.TokenLiteral() + ";"
+}
+
+func (c *ContinueStatement) statementNode() {
+	//TODO implement me
+	panic("implement me")
+}
+
+// AssignExpression covers `name = value` and the compound forms such as `name += value`.
+type AssignExpression struct {
+	Token    token.Token
+	Name     *Identifier
+	Operator string
+	Value    Expression
+}
+
+func (a *AssignExpression) TokenLiteral() string {
+	return a.Token.Literal
+}
+
+func (a *AssignExpression) Pos() token.Position {
+	return a.Token.Pos
+}
+
+func (a *AssignExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(a.Name.String())
+	out.WriteString(" ")
+	out.WriteString(a.Operator)
+	out.WriteString(" ")
+	out.WriteString(a.Value.String())
+	out.WriteString(")")
+
+	return out.String()
+}
+
+func (a *AssignExpression) expressionNode() {
+	//TODO implement me
+	panic("implement me")
+}
+
+// SpreadExpression expands an array into call arguments or array elements: `f(...args)`.
+type SpreadExpression struct {
+	Token token.Token
+	Value Expression
+}
+
+func (s *SpreadExpression) TokenLiteral() string {
+	return s.Token.Literal
+}
+
+func (s *SpreadExpression) Pos() token.Position {
+	return s.Token.Pos
+}
+
+func (s *SpreadExpression) String() string {
+	return "..." + s.Value.String()
+}
+
+func (s *SpreadExpression) expressionNode() {
+	//TODO implement me
+	panic("implement me")
+}
+
+// FunctionStatement declares a named function: `fun name(params) { }`.
+type FunctionStatement struct {
+	Token    token.Token
+	Name     *Identifier
+	Function *FunctionLiteral
+}
+
+func (f *FunctionStatement) TokenLiteral() string {
+	return f.Token.Literal
+}
+
+func (f *FunctionStatement) Pos() token.Position {
+	return f.Token.Pos
+}
+
+func (f *FunctionStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(f.TokenLiteral() + " ")
+	out.WriteString(f.Name.String())
+	out.WriteString("(")
+	out.WriteString(ParameterList(f.Function.Parameters, f.Function.Defaults, f.Function.Rest))
+	out.WriteString(") ")
+	out.WriteString(f.Function.Body.String())
+
+	return out.String()
+}
+
+func (f *FunctionStatement) statementNode() {
+	//TODO implement me
+	panic("implement me")
+}
+
+type ThrowStatement struct {
+	Token token.Token
+	Value Expression
+}
+
+func (t *ThrowStatement) TokenLiteral() string {
+	return t.Token.Literal
+}
+
+func (t *ThrowStatement) Pos() token.Position {
+	return t.Token.Pos
+}
+
+func (t *ThrowStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(t.TokenLiteral() + " ")
+	if t.Value != nil {
+		out.WriteString(t.Value.String())
+	}
+	out.WriteString(";")
+
+	return out.String()
+}
+
+func (t *ThrowStatement) statementNode() {
+	//TODO implement me
+	panic("implement me")
+}
+
+// TryStatement is `try { } catch (e) { } finally { }`, either Catch or Finally may be nil.
+type TryStatement struct {
+	Token   token.Token
+	Block   *BlockStatement
+	Param   *Identifier
+	Catch   *BlockStatement
+	Finally *BlockStatement
+	// CatchSlots is how many variables the resolver found in the catch block, its parameter included
+	CatchSlots int
+}
+
+func (t *TryStatement) TokenLiteral() string {
+	return t.Token.Literal
+}
+
+func (t *TryStatement) Pos() token.Position {
+	return t.Token.Pos
+}
+
+func (t *TryStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("try ")
+	out.WriteString(t.Block.String())
+	if t.Catch != nil {
+		out.WriteString(" catch (")
+		out.WriteString(t.Param.String())
+		out.WriteString(") ")
+		out.WriteString(t.Catch.String())
+	}
+	if t.Finally != nil {
+		out.WriteString(" finally ")
+		out.WriteString(t.Finally.String())
+	}
+
+	return out.String()
+}
+
+func (t *TryStatement) statementNode() {
+	//TODO implement me
+	panic("implement me")
+}
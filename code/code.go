@@ -0,0 +1,304 @@
+package code
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"go-interpreter/token"
+	"sort"
+)
+
+type Instructions []byte
+
+func (ins Instructions) String() string {
+	var out bytes.Buffer
+
+	i := 0
+	for i < len(ins) {
+		def, err := Lookup(ins[i])
+		if err != nil {
+			fmt.Fprintf(&out, "ERROR: %s\n", err)
+			i++
+			continue
+		}
+
+		operands, read := ReadOperands(def, ins[i+1:])
+		fmt.Fprintf(&out, "%04d %s\n", i, fmtInstruction(def, operands))
+
+		i += 1 + read
+	}
+
+	return out.String()
+}
+
+func fmtInstruction(def *Definition, operands []int) string {
+	if len(operands) != len(def.OperandWidths) {
+		return fmt.Sprintf("ERROR: operand len %d does not match defined %d\n", len(operands), len(def.OperandWidths))
+	}
+
+	switch len(operands) {
+	case 0:
+		return def.Name
+	case 1:
+		return fmt.Sprintf("%s %d", def.Name, operands[0])
+	case 2:
+		return fmt.Sprintf("%s %d %d", def.Name, operands[0], operands[1])
+	}
+
+	return fmt.Sprintf("ERROR: unhandled operand count for %s\n", def.Name)
+}
+
+type Opcode byte
+
+const (
+	OpConstant Opcode = iota
+	OpPop
+
+	OpTrue
+	OpFalse
+	OpNull
+
+	OpAdd
+	OpSub
+	OpMul
+	OpDiv
+	OpMod
+	OpPow
+	OpBitAnd
+	OpBitOr
+	OpBitXor
+	OpShiftLeft
+	OpShiftRight
+	OpEqual
+	OpNotEqual
+	OpLessThan
+	OpLessEqual
+	OpGreaterThan
+	OpGreaterEqual
+
+	OpMinus
+	OpBang
+	OpTilde
+
+	OpJump
+	OpJumpNotTruthy
+
+	OpGetGlobal
+	OpDefineGlobal
+	OpAssignGlobal
+	// OpCheckGlobal fails unless the global was declared, it comes before assignments
+	OpCheckGlobal
+	OpGetLocal
+	OpDefineLocal
+	OpAssignLocal
+	// OpCheckLocal and OpCheckFree fail like OpCheckGlobal while the var of the
+	// local hasn't run yet
+	OpCheckLocal
+	OpGetFree
+	OpAssignFree
+	OpCheckFree
+	// OpJumpIfBound skips the default value of a parameter that got an argument
+	OpJumpIfBound
+
+	OpArray
+	OpHash
+	OpAppend
+	OpExtend
+	OpIndex
+
+	OpClosure
+	OpCall
+	OpCallSpread
+	OpReturnValue
+	OpReturn
+
+	OpIter
+	OpIterNext
+
+	OpSetupTry
+	OpPopTry
+	OpCatch
+	OpThrow
+	OpRethrow
+	OpError
+)
+
+type Definition struct {
+	Name          string
+	OperandWidths []int
+}
+
+var definitions = map[Opcode]*Definition{
+	OpConstant: {"OpConstant", []int{2}},
+	OpPop:      {"OpPop", []int{}},
+
+	OpTrue:  {"OpTrue", []int{}},
+	OpFalse: {"OpFalse", []int{}},
+	OpNull:  {"OpNull", []int{}},
+
+	OpAdd:          {"OpAdd", []int{}},
+	OpSub:          {"OpSub", []int{}},
+	OpMul:          {"OpMul", []int{}},
+	OpDiv:          {"OpDiv", []int{}},
+	OpMod:          {"OpMod", []int{}},
+	OpPow:          {"OpPow", []int{}},
+	OpBitAnd:       {"OpBitAnd", []int{}},
+	OpBitOr:        {"OpBitOr", []int{}},
+	OpBitXor:       {"OpBitXor", []int{}},
+	OpShiftLeft:    {"OpShiftLeft", []int{}},
+	OpShiftRight:   {"OpShiftRight", []int{}},
+	OpEqual:        {"OpEqual", []int{}},
+	OpNotEqual:     {"OpNotEqual", []int{}},
+	OpLessThan:     {"OpLessThan", []int{}},
+	OpLessEqual:    {"OpLessEqual", []int{}},
+	OpGreaterThan:  {"OpGreaterThan", []int{}},
+	OpGreaterEqual: {"OpGreaterEqual", []int{}},
+
+	OpMinus: {"OpMinus", []int{}},
+	OpBang:  {"OpBang", []int{}},
+	OpTilde: {"OpTilde", []int{}},
+
+	OpJump:          {"OpJump", []int{2}},
+	OpJumpNotTruthy: {"OpJumpNotTruthy", []int{2}},
+
+	OpGetGlobal:    {"OpGetGlobal", []int{2}},
+	OpDefineGlobal: {"OpDefineGlobal", []int{2}},
+	OpAssignGlobal: {"OpAssignGlobal", []int{2}},
+	OpCheckGlobal:  {"OpCheckGlobal", []int{2}},
+	OpGetLocal:     {"OpGetLocal", []int{2}},
+	OpDefineLocal:  {"OpDefineLocal", []int{2}},
+	OpAssignLocal:  {"OpAssignLocal", []int{2}},
+	OpCheckLocal:   {"OpCheckLocal", []int{2}},
+	OpGetFree:      {"OpGetFree", []int{1, 2}},
+	OpAssignFree:   {"OpAssignFree", []int{1, 2}},
+	OpCheckFree:    {"OpCheckFree", []int{1, 2}},
+	OpJumpIfBound:  {"OpJumpIfBound", []int{2, 2}},
+
+	OpArray:  {"OpArray", []int{2}},
+	OpHash:   {"OpHash", []int{2}},
+	OpAppend: {"OpAppend", []int{}},
+	OpExtend: {"OpExtend", []int{}},
+	OpIndex:  {"OpIndex", []int{}},
+
+	OpClosure:     {"OpClosure", []int{2}},
+	OpCall:        {"OpCall", []int{2}},
+	OpCallSpread:  {"OpCallSpread", []int{}},
+	OpReturnValue: {"OpReturnValue", []int{}},
+	OpReturn:      {"OpReturn", []int{}},
+
+	OpIter:     {"OpIter", []int{}},
+	OpIterNext: {"OpIterNext", []int{2}},
+
+	OpSetupTry: {"OpSetupTry", []int{2}},
+	OpPopTry:   {"OpPopTry", []int{}},
+	OpCatch:    {"OpCatch", []int{}},
+	OpThrow:    {"OpThrow", []int{}},
+	OpRethrow:  {"OpRethrow", []int{}},
+	OpError:    {"OpError", []int{2}},
+}
+
+func Lookup(op byte) (*Definition, error) {
+	def, ok := definitions[Opcode(op)]
+	if !ok {
+		return nil, fmt.Errorf("opcode %d undefined", op)
+	}
+
+	return def, nil
+}
+
+func Make(op Opcode, operands ...int) []byte {
+	def, ok := definitions[op]
+	if !ok {
+		return []byte{}
+	}
+
+	instructionLen := 1
+	for _, w := range def.OperandWidths {
+		instructionLen += w
+	}
+
+	instruction := make([]byte, instructionLen)
+	instruction[0] = byte(op)
+
+	offset := 1
+	for i, o := range operands {
+		width := def.OperandWidths[i]
+		switch width {
+		case 2:
+			binary.BigEndian.PutUint16(instruction[offset:], uint16(o))
+		case 1:
+			instruction[offset] = byte(o)
+		}
+		offset += width
+	}
+
+	return instruction
+}
+
+// CheckOperands returns an error when an operand doesn't fit in the width op gives it.
+func CheckOperands(op Opcode, operands ...int) error {
+	def, err := Lookup(byte(op))
+	if err != nil {
+		return err
+	}
+
+	for i, o := range operands {
+		width := def.OperandWidths[i]
+		if o < 0 || o >= 1<<(8*width) {
+			return fmt.Errorf("operand %d of %s does not fit in %d bytes", o, def.Name, width)
+		}
+	}
+
+	return nil
+}
+
+func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
+	operands := make([]int, len(def.OperandWidths))
+	offset := 0
+
+	for i, width := range def.OperandWidths {
+		switch width {
+		case 2:
+			operands[i] = int(ReadUint16(ins[offset:]))
+		case 1:
+			operands[i] = int(ReadUint8(ins[offset:]))
+		}
+		offset += width
+	}
+
+	return operands, offset
+}
+
+func ReadUint16(ins Instructions) uint16 {
+	return binary.BigEndian.Uint16(ins)
+}
+
+func ReadUint8(ins Instructions) uint8 {
+	return ins[0]
+}
+
+// SourcePosition marks where the instructions starting at Offset came from.
+type SourcePosition struct {
+	Offset int
+	Pos    token.Position
+}
+
+// PositionTable maps instruction offsets back to the source, sorted by offset.
+type PositionTable []SourcePosition
+
+// Add records pos for the instruction at offset, unless it continues the previous position.
+func (t PositionTable) Add(offset int, pos token.Position) PositionTable {
+	if len(t) > 0 && t[len(t)-1].Pos == pos {
+		return t
+	}
+	return append(t, SourcePosition{Offset: offset, Pos: pos})
+}
+
+// Lookup returns the position of the instruction at offset.
+func (t PositionTable) Lookup(offset int) token.Position {
+	i := sort.Search(len(t), func(i int) bool { return t[i].Offset > offset })
+	if i == 0 {
+		return token.Position{}
+	}
+	return t[i-1].Pos
+}
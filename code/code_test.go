@@ -0,0 +1,142 @@
+package code
+
+import (
+	"go-interpreter/token"
+	"testing"
+)
+
+func TestMake(t *testing.T) {
+	tests := []struct {
+		op       Opcode
+		operands []int
+		expected []byte
+	}{
+		{OpConstant, []int{65534}, []byte{byte(OpConstant), 255, 254}},
+		{OpAdd, []int{}, []byte{byte(OpAdd)}},
+		{OpGetFree, []int{2, 300}, []byte{byte(OpGetFree), 2, 1, 44}},
+	}
+
+	for _, tt := range tests {
+		instruction := Make(tt.op, tt.operands...)
+
+		if len(instruction) != len(tt.expected) {
+			t.Fatalf("instruction has wrong length. want=%d, got=%d", len(tt.expected), len(instruction))
+		}
+
+		for i, b := range tt.expected {
+			if instruction[i] != b {
+				t.Errorf("wrong byte at pos %d. want=%d, got=%d", i, b, instruction[i])
+			}
+		}
+	}
+}
+
+func TestCheckOperands(t *testing.T) {
+	tests := []struct {
+		op       Opcode
+		operands []int
+		expected string
+	}{
+		{OpConstant, []int{65535}, ""},
+		{OpConstant, []int{65536}, "operand 65536 of OpConstant does not fit in 2 bytes"},
+		{OpJump, []int{-1}, "operand -1 of OpJump does not fit in 2 bytes"},
+		{OpGetFree, []int{255, 65535}, ""},
+		{OpGetFree, []int{256, 0}, "operand 256 of OpGetFree does not fit in 1 bytes"},
+	}
+
+	for _, tt := range tests {
+		err := CheckOperands(tt.op, tt.operands...)
+		message := ""
+		if err != nil {
+			message = err.Error()
+		}
+		if message != tt.expected {
+			t.Errorf("wrong error for %v, got=%q, want=%q", tt.operands, message, tt.expected)
+		}
+	}
+}
+
+func TestInstructionsString(t *testing.T) {
+	instructions := []Instructions{
+		Make(OpAdd),
+		Make(OpGetLocal, 1),
+		Make(OpConstant, 2),
+		Make(OpJumpIfBound, 0, 65535),
+	}
+
+	expected := `0000 OpAdd
+0001 OpGetLocal 1
+0004 OpConstant 2
+0007 OpJumpIfBound 0 65535
+`
+
+	concatted := Instructions{}
+	for _, ins := range instructions {
+		concatted = append(concatted, ins...)
+	}
+
+	if concatted.String() != expected {
+		t.Errorf("instructions wrongly formatted.\nwant=%q\ngot=%q", expected, concatted.String())
+	}
+}
+
+func TestReadOperands(t *testing.T) {
+	tests := []struct {
+		op        Opcode
+		operands  []int
+		bytesRead int
+	}{
+		{OpConstant, []int{65535}, 2},
+		{OpGetFree, []int{255, 1}, 3},
+	}
+
+	for _, tt := range tests {
+		instruction := Make(tt.op, tt.operands...)
+
+		def, err := Lookup(byte(tt.op))
+		if err != nil {
+			t.Fatalf("definition not found: %q\n", err)
+		}
+
+		operandsRead, n := ReadOperands(def, instruction[1:])
+		if n != tt.bytesRead {
+			t.Fatalf("n wrong. want=%d, got=%d", tt.bytesRead, n)
+		}
+
+		for i, want := range tt.operands {
+			if operandsRead[i] != want {
+				t.Errorf("operand wrong. want=%d, got=%d", want, operandsRead[i])
+			}
+		}
+	}
+}
+
+func TestPositionTable(t *testing.T) {
+	first := token.Position{Line: 1, Column: 1}
+	second := token.Position{Line: 2, Column: 5}
+
+	var table PositionTable
+	table = table.Add(0, first)
+	table = table.Add(3, first)
+	table = table.Add(4, second)
+
+	if len(table) != 2 {
+		t.Fatalf("repeated position was recorded again, got=%d entries", len(table))
+	}
+
+	tests := []struct {
+		offset   int
+		expected token.Position
+	}{
+		{0, first},
+		{3, first},
+		{4, second},
+		{10, second},
+	}
+
+	for _, tt := range tests {
+		if pos := table.Lookup(tt.offset); pos != tt.expected {
+			t.Errorf("wrong position for offset %d, got=%s, want=%s", tt.offset, pos, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,921 @@
+package compiler
+
+import (
+	"fmt"
+	"go-interpreter/ast"
+	"go-interpreter/code"
+	"go-interpreter/object"
+	"go-interpreter/token"
+	"math"
+	"strings"
+)
+
+// Bytecode is a compiled program: Main runs the top-level statements and
+// Globals names the global slots, by index.
+type Bytecode struct {
+	Main      *object.CompiledFunction
+	Constants []object.Object
+	Globals   []string
+}
+
+type Compiler struct {
+	constants   []object.Object
+	symbolTable *SymbolTable
+
+	scopes []*CompilationScope
+	// pos is the position of the node being compiled, recorded for every instruction
+	pos token.Position
+	// operandError is the first operand emit couldn't encode, Compile returns it
+	operandError error
+}
+
+// CompilationScope collects the instructions of the function being compiled.
+type CompilationScope struct {
+	instructions code.Instructions
+	positions    code.PositionTable
+	names        map[int]string
+
+	loops []*loop
+	tries []*tryBlock
+}
+
+// loop tracks the jumps that break and continue emit until their targets are known.
+type loop struct {
+	continueTarget int
+	continues      []int
+	breaks         []int
+	// tries is how many try blocks were open when the loop started
+	tries int
+}
+
+// tryBlock is an open try (or catch) block, leaving it early has to run finally.
+type tryBlock struct {
+	finally *ast.BlockStatement
+}
+
+func New() *Compiler {
+	return NewWithState(NewSymbolTable(), []object.Object{})
+}
+
+// NewWithState continues where another compiler stopped, so the REPL keeps its globals.
+func NewWithState(symbolTable *SymbolTable, constants []object.Object) *Compiler {
+	return &Compiler{
+		constants:   constants,
+		symbolTable: symbolTable,
+		scopes:      []*CompilationScope{{names: make(map[int]string)}},
+	}
+}
+
+func (c *Compiler) Compile(node ast.Node) error {
+	if err := c.compile(node); err != nil {
+		return err
+	}
+	return c.operandError
+}
+
+func (c *Compiler) compile(node ast.Node) error {
+	saved := c.pos
+	if node.Pos().IsValid() {
+		c.pos = node.Pos()
+	}
+	defer func() { c.pos = saved }()
+
+	switch node := node.(type) {
+	case *ast.Program:
+		return c.compileProgram(node)
+	case *ast.ExpressionStatement:
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+		c.emit(code.OpPop)
+	case *ast.BlockStatement:
+		return c.compileStatements(node.Statements, false)
+	case *ast.VarStatement:
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+		c.emitDefine(c.symbolTable.Define(node.Name.Value))
+	case *ast.FunctionStatement:
+		// already compiled by hoistFunctions when the enclosing block started
+	case *ast.ReturnStatement:
+		if err := c.Compile(node.ReturnValue); err != nil {
+			return err
+		}
+		if err := c.leaveTries(0); err != nil {
+			return err
+		}
+		c.emit(code.OpReturnValue)
+	case *ast.ThrowStatement:
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+		c.emit(code.OpThrow)
+	case *ast.TryStatement:
+		return c.compileTryStatement(node, false)
+	case *ast.WhileStatement:
+		return c.compileWhileStatement(node)
+	case *ast.ForStatement:
+		return c.compileForStatement(node)
+	case *ast.ForInStatement:
+		return c.compileForInStatement(node)
+	case *ast.BreakStatement:
+		return c.compileBreakStatement()
+	case *ast.ContinueStatement:
+		return c.compileContinueStatement()
+
+	case *ast.IntegerLiteral:
+		return c.emitConstant(&object.Integer{Value: node.Value})
+	case *ast.FloatLiteral:
+		return c.emitConstant(&object.Float{Value: node.Value})
+	case *ast.StringLiteral:
+		return c.emitConstant(&object.String{Value: node.Value})
+	case *ast.Boolean:
+		if node.Value {
+			c.emit(code.OpTrue)
+		} else {
+			c.emit(code.OpFalse)
+		}
+	case *ast.Identifier:
+		c.emitGet(c.resolve(node.Value), node.Value)
+	case *ast.PrefixExpression:
+		if err := c.Compile(node.Right); err != nil {
+			return err
+		}
+		switch node.Operator {
+		case "-":
+			c.emit(code.OpMinus)
+		case "!":
+			c.emit(code.OpBang)
+		case "~":
+			c.emit(code.OpTilde)
+		default:
+			return fmt.Errorf("unknown operator %s", node.Operator)
+		}
+	case *ast.InfixExpression:
+		if node.Operator == "&&" || node.Operator == "||" {
+			return c.compileLogicalExpression(node)
+		}
+
+		if err := c.Compile(node.Left); err != nil {
+			return err
+		}
+		if err := c.Compile(node.Right); err != nil {
+			return err
+		}
+		return c.emitInfix(node.Operator)
+	case *ast.AssignExpression:
+		return c.compileAssignExpression(node)
+	case *ast.IfExpression:
+		return c.compileIfExpression(node)
+	case *ast.ArrayLiteral:
+		return c.compileElements(node.Elements, code.OpArray)
+	case *ast.HashLiteral:
+		if len(node.Pairs) > math.MaxUint16 {
+			return fmt.Errorf("too many pairs in hash literal: %d", len(node.Pairs))
+		}
+		for _, pair := range node.Pairs {
+			if err := c.Compile(pair.Key); err != nil {
+				return err
+			}
+			if err := c.Compile(pair.Value); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpHash, len(node.Pairs))
+	case *ast.IndexExpression:
+		if err := c.Compile(node.Left); err != nil {
+			return err
+		}
+		if err := c.Compile(node.Index); err != nil {
+			return err
+		}
+		c.emit(code.OpIndex)
+	case *ast.SpreadExpression:
+		return c.emitError("spread is only allowed in call arguments and array literals")
+	case *ast.FunctionLiteral:
+		return c.compileFunctionLiteral(node)
+	case *ast.CallExpression:
+		return c.compileCallExpression(node)
+	default:
+		return fmt.Errorf("cannot compile %T", node)
+	}
+
+	return nil
+}
+
+// Bytecode hands every compiled function the constants of the program, so
+// they keep running after the next program is compiled with new constants.
+func (c *Compiler) Bytecode() *Bytecode {
+	scope := c.scope()
+	for _, constant := range c.constants {
+		if fn, ok := constant.(*object.CompiledFunction); ok {
+			fn.Constants = c.constants
+		}
+	}
+
+	return &Bytecode{
+		Main: &object.CompiledFunction{
+			Instructions: scope.instructions,
+			Constants:    c.constants,
+			Positions:    scope.positions,
+			Names:        scope.names,
+		},
+		Constants: c.constants,
+		Globals:   c.symbolTable.Global().Names(),
+	}
+}
+
+// compileProgram leaves the value of the last statement as the result of the
+// program, or no result when that statement has none, like a declaration.
+func (c *Compiler) compileProgram(program *ast.Program) error {
+	if err := c.hoistFunctions(program.Statements); err != nil {
+		return err
+	}
+
+	for i, statement := range program.Statements {
+		if i == len(program.Statements)-1 && hasValue(statement) {
+			if err := c.compileValue(statement); err != nil {
+				return err
+			}
+			c.emit(code.OpReturnValue)
+			return nil
+		}
+
+		if err := c.Compile(statement); err != nil {
+			return err
+		}
+	}
+
+	c.emit(code.OpReturn)
+	return nil
+}
+
+// compileStatements compiles a block. When valued, the value of its last
+// statement is left on the stack, null if there is none.
+func (c *Compiler) compileStatements(statements []ast.Statement, valued bool) error {
+	if err := c.hoistFunctions(statements); err != nil {
+		return err
+	}
+
+	for i, statement := range statements {
+		if valued && i == len(statements)-1 {
+			return c.compileValue(statement)
+		}
+		if err := c.Compile(statement); err != nil {
+			return err
+		}
+	}
+
+	if valued {
+		c.emit(code.OpNull)
+	}
+	return nil
+}
+
+func hasValue(statement ast.Statement) bool {
+	switch statement.(type) {
+	case *ast.ExpressionStatement, *ast.TryStatement, *ast.WhileStatement, *ast.ForStatement, *ast.ForInStatement:
+		return true
+	default:
+		return false
+	}
+}
+
+// compileValue compiles a statement so that it leaves its value on the stack.
+// Statements that jump away, like return, leave nothing as nothing runs after them.
+func (c *Compiler) compileValue(statement ast.Statement) error {
+	switch statement := statement.(type) {
+	case *ast.ExpressionStatement:
+		return c.Compile(statement.Value)
+	case *ast.TryStatement:
+		return c.compileTryStatement(statement, true)
+	case *ast.ReturnStatement, *ast.ThrowStatement, *ast.BreakStatement, *ast.ContinueStatement:
+		return c.Compile(statement)
+	default:
+		if err := c.Compile(statement); err != nil {
+			return err
+		}
+		c.emit(code.OpNull)
+		return nil
+	}
+}
+
+// hoistFunctions defines every function declared in a block before the block
+// runs, so declarations can call each other regardless of their order.
+func (c *Compiler) hoistFunctions(statements []ast.Statement) error {
+	for _, statement := range statements {
+		declaration, ok := statement.(*ast.FunctionStatement)
+		if !ok {
+			continue
+		}
+
+		symbol := c.symbolTable.Define(declaration.Name.Value)
+		if err := c.Compile(declaration.Function); err != nil {
+			return err
+		}
+		c.emitDefine(symbol)
+	}
+	return nil
+}
+
+// declareLocals defines the variables a function body declares anywhere outside
+// nested functions and catch blocks up front, so closures created before a
+// declaration already see its slot.
+func (c *Compiler) declareLocals(statements []ast.Statement) {
+	for _, statement := range statements {
+		switch statement := statement.(type) {
+		case *ast.VarStatement:
+			c.symbolTable.Define(statement.Name.Value)
+		case *ast.FunctionStatement:
+			c.symbolTable.Define(statement.Name.Value)
+		case *ast.ExpressionStatement:
+			if ifExpression, ok := statement.Value.(*ast.IfExpression); ok {
+				c.declareLocals(ifExpression.Consequence.Statements)
+				if ifExpression.Alternative != nil {
+					c.declareLocals(ifExpression.Alternative.Statements)
+				}
+			}
+		case *ast.WhileStatement:
+			c.declareLocals(statement.Body.Statements)
+		case *ast.ForStatement:
+			if statement.Init != nil {
+				c.declareLocals([]ast.Statement{statement.Init})
+			}
+			c.declareLocals(statement.Body.Statements)
+		case *ast.ForInStatement:
+			c.symbolTable.Define(statement.Variable.Value)
+			c.declareLocals(statement.Body.Statements)
+		case *ast.TryStatement:
+			c.declareLocals(statement.Block.Statements)
+			if statement.Finally != nil {
+				c.declareLocals(statement.Finally.Statements)
+			}
+		}
+	}
+}
+
+func (c *Compiler) compileIfExpression(node *ast.IfExpression) error {
+	if err := c.Compile(node.Condition); err != nil {
+		return err
+	}
+	jumpNotTruthy := c.emit(code.OpJumpNotTruthy, 9999)
+
+	if err := c.compileStatements(node.Consequence.Statements, true); err != nil {
+		return err
+	}
+	jump := c.emit(code.OpJump, 9999)
+
+	c.changeOperand(jumpNotTruthy, len(c.scope().instructions))
+	if node.Alternative != nil {
+		if err := c.compileStatements(node.Alternative.Statements, true); err != nil {
+			return err
+		}
+	} else {
+		c.emit(code.OpNull)
+	}
+	c.changeOperand(jump, len(c.scope().instructions))
+
+	return nil
+}
+
+// compileLogicalExpression only evaluates the right side when the left one
+// doesn't decide the result, which is always a Boolean.
+func (c *Compiler) compileLogicalExpression(node *ast.InfixExpression) error {
+	if err := c.Compile(node.Left); err != nil {
+		return err
+	}
+	jumpNotTruthy := c.emit(code.OpJumpNotTruthy, 9999)
+
+	var jump int
+	if node.Operator == "&&" {
+		if err := c.compileTruthiness(node.Right); err != nil {
+			return err
+		}
+		jump = c.emit(code.OpJump, 9999)
+		c.changeOperand(jumpNotTruthy, len(c.scope().instructions))
+		c.emit(code.OpFalse)
+	} else {
+		c.emit(code.OpTrue)
+		jump = c.emit(code.OpJump, 9999)
+		c.changeOperand(jumpNotTruthy, len(c.scope().instructions))
+		if err := c.compileTruthiness(node.Right); err != nil {
+			return err
+		}
+	}
+
+	c.changeOperand(jump, len(c.scope().instructions))
+	return nil
+}
+
+func (c *Compiler) compileTruthiness(node ast.Expression) error {
+	if err := c.Compile(node); err != nil {
+		return err
+	}
+	c.emit(code.OpBang)
+	c.emit(code.OpBang)
+	return nil
+}
+
+var infixOpcodes = map[string]code.Opcode{
+	"+":  code.OpAdd,
+	"-":  code.OpSub,
+	"*":  code.OpMul,
+	"/":  code.OpDiv,
+	"%":  code.OpMod,
+	"**": code.OpPow,
+	"&":  code.OpBitAnd,
+	"|":  code.OpBitOr,
+	"^":  code.OpBitXor,
+	"<<": code.OpShiftLeft,
+	">>": code.OpShiftRight,
+	"==": code.OpEqual,
+	"!=": code.OpNotEqual,
+	"<":  code.OpLessThan,
+	"<=": code.OpLessEqual,
+	">":  code.OpGreaterThan,
+	">=": code.OpGreaterEqual,
+}
+
+func (c *Compiler) emitInfix(operator string) error {
+	op, ok := infixOpcodes[operator]
+	if !ok {
+		return fmt.Errorf("unknown operator %s", operator)
+	}
+	c.emit(op)
+	return nil
+}
+
+func (c *Compiler) compileAssignExpression(node *ast.AssignExpression) error {
+	name := node.Name.Value
+	symbol := c.resolve(name)
+	switch symbol.Scope {
+	case GlobalScope:
+		c.emit(code.OpCheckGlobal, symbol.Index)
+	case LocalScope:
+		c.emit(code.OpCheckLocal, symbol.Index)
+	case FreeScope:
+		position := c.emit(code.OpCheckFree, symbol.Depth, symbol.Index)
+		c.scope().names[position] = name
+	}
+
+	if node.Operator != "=" {
+		c.emitGet(symbol, name)
+	}
+	if err := c.Compile(node.Value); err != nil {
+		return err
+	}
+	if node.Operator != "=" {
+		if err := c.emitInfix(strings.TrimSuffix(node.Operator, "=")); err != nil {
+			return err
+		}
+	}
+
+	switch symbol.Scope {
+	case GlobalScope:
+		c.emit(code.OpAssignGlobal, symbol.Index)
+	case LocalScope:
+		c.emit(code.OpAssignLocal, symbol.Index)
+	case FreeScope:
+		c.emit(code.OpAssignFree, symbol.Depth, symbol.Index)
+	}
+	return nil
+}
+
+func (c *Compiler) compileWhileStatement(node *ast.WhileStatement) error {
+	start := len(c.scope().instructions)
+	l := c.enterLoop(start)
+
+	if err := c.Compile(node.Condition); err != nil {
+		return err
+	}
+	jumpNotTruthy := c.emit(code.OpJumpNotTruthy, 9999)
+
+	if err := c.compileStatements(node.Body.Statements, false); err != nil {
+		return err
+	}
+	c.emit(code.OpJump, start)
+
+	c.changeOperand(jumpNotTruthy, len(c.scope().instructions))
+	c.leaveLoop(l)
+	return nil
+}
+
+func (c *Compiler) compileForStatement(node *ast.ForStatement) error {
+	if node.Init != nil {
+		if err := c.Compile(node.Init); err != nil {
+			return err
+		}
+	}
+
+	start := len(c.scope().instructions)
+	l := c.enterLoop(-1)
+
+	jumpNotTruthy := -1
+	if node.Condition != nil {
+		if err := c.Compile(node.Condition); err != nil {
+			return err
+		}
+		jumpNotTruthy = c.emit(code.OpJumpNotTruthy, 9999)
+	}
+
+	if err := c.compileStatements(node.Body.Statements, false); err != nil {
+		return err
+	}
+
+	l.continueTarget = len(c.scope().instructions)
+	if node.Step != nil {
+		if err := c.Compile(node.Step); err != nil {
+			return err
+		}
+		c.emit(code.OpPop)
+	}
+	c.emit(code.OpJump, start)
+
+	if jumpNotTruthy != -1 {
+		c.changeOperand(jumpNotTruthy, len(c.scope().instructions))
+	}
+	c.leaveLoop(l)
+	return nil
+}
+
+// compileForInStatement keeps an iterator on the stack while the loop runs.
+func (c *Compiler) compileForInStatement(node *ast.ForInStatement) error {
+	if err := c.Compile(node.Iterable); err != nil {
+		return err
+	}
+	c.emit(code.OpIter)
+
+	start := len(c.scope().instructions)
+	l := c.enterLoop(start)
+
+	next := c.emit(code.OpIterNext, 9999)
+	c.emitDefine(c.symbolTable.Define(node.Variable.Value))
+
+	if err := c.compileStatements(node.Body.Statements, false); err != nil {
+		return err
+	}
+	c.emit(code.OpJump, start)
+
+	c.changeOperand(next, len(c.scope().instructions))
+	c.leaveLoop(l)
+	c.emit(code.OpPop)
+	return nil
+}
+
+func (c *Compiler) enterLoop(continueTarget int) *loop {
+	scope := c.scope()
+	l := &loop{continueTarget: continueTarget, tries: len(scope.tries)}
+	scope.loops = append(scope.loops, l)
+	return l
+}
+
+// leaveLoop points the pending break and continue jumps at their targets, breaks
+// land on the current instruction.
+func (c *Compiler) leaveLoop(l *loop) {
+	scope := c.scope()
+	scope.loops = scope.loops[:len(scope.loops)-1]
+
+	for _, position := range l.breaks {
+		c.changeOperand(position, len(scope.instructions))
+	}
+	for _, position := range l.continues {
+		c.changeOperand(position, l.continueTarget)
+	}
+}
+
+func (c *Compiler) compileBreakStatement() error {
+	scope := c.scope()
+	if len(scope.loops) == 0 {
+		return fmt.Errorf("break outside of loop")
+	}
+
+	l := scope.loops[len(scope.loops)-1]
+	if err := c.leaveTries(l.tries); err != nil {
+		return err
+	}
+	l.breaks = append(l.breaks, c.emit(code.OpJump, 9999))
+	return nil
+}
+
+func (c *Compiler) compileContinueStatement() error {
+	scope := c.scope()
+	if len(scope.loops) == 0 {
+		return fmt.Errorf("continue outside of loop")
+	}
+
+	l := scope.loops[len(scope.loops)-1]
+	if err := c.leaveTries(l.tries); err != nil {
+		return err
+	}
+	l.continues = append(l.continues, c.emit(code.OpJump, 9999))
+	return nil
+}
+
+// compileTryStatement protects the try block with a handler. Errors land on
+// the catch block, which gets its own handler when a finally block has to run
+// after it fails, or on a copy of the finally block that raises the error again.
+func (c *Compiler) compileTryStatement(node *ast.TryStatement, valued bool) error {
+	handler := c.emit(code.OpSetupTry, 9999)
+	if err := c.compileProtected(node.Block, node.Finally, valued); err != nil {
+		return err
+	}
+	c.emit(code.OpPopTry)
+	exits := []int{c.emit(code.OpJump, 9999)}
+
+	c.changeOperand(handler, len(c.scope().instructions))
+	if node.Catch != nil {
+		c.emit(code.OpCatch)
+		c.symbolTable = NewBlockSymbolTable(c.symbolTable)
+		c.emitDefine(c.symbolTable.Define(node.Param.Value))
+
+		var err error
+		if node.Finally == nil {
+			err = c.compileStatements(node.Catch.Statements, valued)
+		} else {
+			handler = c.emit(code.OpSetupTry, 9999)
+			err = c.compileProtected(node.Catch, node.Finally, valued)
+			c.emit(code.OpPopTry)
+		}
+		c.symbolTable = c.symbolTable.Outer
+		if err != nil {
+			return err
+		}
+
+		if node.Finally == nil {
+			c.changeOperand(exits[0], len(c.scope().instructions))
+			return nil
+		}
+		exits = append(exits, c.emit(code.OpJump, 9999))
+		c.changeOperand(handler, len(c.scope().instructions))
+	}
+
+	if err := c.compileStatements(node.Finally.Statements, false); err != nil {
+		return err
+	}
+	c.emit(code.OpRethrow)
+
+	for _, exit := range exits {
+		c.changeOperand(exit, len(c.scope().instructions))
+	}
+	return c.compileStatements(node.Finally.Statements, false)
+}
+
+func (c *Compiler) compileProtected(block *ast.BlockStatement, finally *ast.BlockStatement, valued bool) error {
+	scope := c.scope()
+	scope.tries = append(scope.tries, &tryBlock{finally: finally})
+	err := c.compileStatements(block.Statements, valued)
+	scope.tries = scope.tries[:len(scope.tries)-1]
+	return err
+}
+
+// leaveTries closes the try blocks opened after the first depth ones, running
+// their finally blocks, before a return, break or continue jumps out of them.
+func (c *Compiler) leaveTries(depth int) error {
+	scope := c.scope()
+	tries := scope.tries
+	defer func() { scope.tries = tries }()
+
+	for i := len(tries) - 1; i >= depth; i-- {
+		c.emit(code.OpPopTry)
+		if tries[i].finally == nil {
+			continue
+		}
+
+		scope.tries = tries[:i]
+		if err := c.compileStatements(tries[i].finally.Statements, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Compiler) compileFunctionLiteral(node *ast.FunctionLiteral) error {
+	c.enterScope()
+
+	for _, parameter := range node.Parameters {
+		c.symbolTable.Define(parameter.Value)
+	}
+	if node.Rest != nil {
+		c.symbolTable.Define(node.Rest.Value)
+	}
+	c.declareLocals(node.Body.Statements)
+
+	numDefaults := 0
+	for i, value := range node.Defaults {
+		if value == nil {
+			continue
+		}
+		numDefaults++
+
+		jump := c.emit(code.OpJumpIfBound, i, 9999)
+		if err := c.Compile(value); err != nil {
+			return err
+		}
+		c.emit(code.OpDefineLocal, i)
+		c.changeOperandAt(jump, 1, len(c.scope().instructions))
+	}
+
+	if err := c.compileStatements(node.Body.Statements, true); err != nil {
+		return err
+	}
+	c.emit(code.OpReturnValue)
+
+	localNames := c.symbolTable.Names()
+	scope := c.leaveScope()
+
+	fn := &object.CompiledFunction{
+		Name:          node.Name,
+		Instructions:  scope.instructions,
+		NumLocals:     len(localNames),
+		NumParameters: len(node.Parameters),
+		NumDefaults:   numDefaults,
+		Variadic:      node.Rest != nil,
+		LocalNames:    localNames,
+		Positions:     scope.positions,
+		Names:         scope.names,
+		Signature:     ast.ParameterList(node.Parameters, node.Defaults, node.Rest),
+		Body:          node.Body.String(),
+	}
+
+	index, err := c.addConstant(fn)
+	if err != nil {
+		return err
+	}
+	c.emit(code.OpClosure, index)
+	return nil
+}
+
+func (c *Compiler) compileCallExpression(node *ast.CallExpression) error {
+	if err := c.Compile(node.Function); err != nil {
+		return err
+	}
+
+	var call int
+	if hasSpread(node.Arguments) || len(node.Arguments) > math.MaxUint16 {
+		if err := c.compileElements(node.Arguments, code.OpArray); err != nil {
+			return err
+		}
+		call = c.emit(code.OpCallSpread)
+	} else {
+		for _, argument := range node.Arguments {
+			if err := c.Compile(argument); err != nil {
+				return err
+			}
+		}
+		call = c.emit(code.OpCall, len(node.Arguments))
+	}
+
+	if identifier, ok := node.Function.(*ast.Identifier); ok {
+		c.scope().names[call] = identifier.Value
+	}
+	return nil
+}
+
+// compileElements pushes an array of the elements, spreading the ones marked with `...`.
+func (c *Compiler) compileElements(elements []ast.Expression, op code.Opcode) error {
+	if !hasSpread(elements) && len(elements) <= math.MaxUint16 {
+		for _, element := range elements {
+			if err := c.Compile(element); err != nil {
+				return err
+			}
+		}
+		c.emit(op, len(elements))
+		return nil
+	}
+
+	c.emit(code.OpArray, 0)
+	for _, element := range elements {
+		spread, ok := element.(*ast.SpreadExpression)
+		if !ok {
+			if err := c.Compile(element); err != nil {
+				return err
+			}
+			c.emit(code.OpAppend)
+			continue
+		}
+
+		if err := c.Compile(spread.Value); err != nil {
+			return err
+		}
+		saved := c.pos
+		c.pos = spread.Pos()
+		c.emit(code.OpExtend)
+		c.pos = saved
+	}
+	return nil
+}
+
+func hasSpread(expressions []ast.Expression) bool {
+	for _, expression := range expressions {
+		if _, ok := expression.(*ast.SpreadExpression); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// resolve finds the variable called name. Names that aren't declared anywhere
+// are taken to be globals, which may still be declared later or be builtins.
+func (c *Compiler) resolve(name string) Symbol {
+	if symbol, ok := c.symbolTable.Resolve(name); ok {
+		return symbol
+	}
+	return c.symbolTable.Global().Define(name)
+}
+
+func (c *Compiler) emitGet(symbol Symbol, name string) {
+	switch symbol.Scope {
+	case GlobalScope:
+		c.emit(code.OpGetGlobal, symbol.Index)
+	case LocalScope:
+		c.emit(code.OpGetLocal, symbol.Index)
+	case FreeScope:
+		position := c.emit(code.OpGetFree, symbol.Depth, symbol.Index)
+		c.scope().names[position] = name
+	}
+}
+
+func (c *Compiler) emitDefine(symbol Symbol) {
+	if symbol.Scope == GlobalScope {
+		c.emit(code.OpDefineGlobal, symbol.Index)
+	} else {
+		c.emit(code.OpDefineLocal, symbol.Index)
+	}
+}
+
+func (c *Compiler) emitConstant(obj object.Object) error {
+	index, err := c.addConstant(obj)
+	if err != nil {
+		return err
+	}
+	c.emit(code.OpConstant, index)
+	return nil
+}
+
+// emitError raises a runtime error when the instruction runs, for code the
+// tree-walker only rejects once it gets there.
+func (c *Compiler) emitError(message string) error {
+	index, err := c.addConstant(&object.String{Value: message})
+	if err != nil {
+		return err
+	}
+	c.emit(code.OpError, index)
+	return nil
+}
+
+func (c *Compiler) addConstant(obj object.Object) (int, error) {
+	if len(c.constants) > math.MaxUint16 {
+		return 0, fmt.Errorf("too many constants")
+	}
+	c.constants = append(c.constants, obj)
+	return len(c.constants) - 1, nil
+}
+
+func (c *Compiler) emit(op code.Opcode, operands ...int) int {
+	c.checkOperands(op, operands...)
+	scope := c.scope()
+	position := len(scope.instructions)
+	scope.positions = scope.positions.Add(position, c.pos)
+	scope.instructions = append(scope.instructions, code.Make(op, operands...)...)
+	return position
+}
+
+func (c *Compiler) changeOperand(position int, operand int) {
+	c.changeOperandAt(position, 0, operand)
+}
+
+// changeOperandAt rewrites the i-th operand of the instruction at position.
+func (c *Compiler) changeOperandAt(position int, i int, operand int) {
+	ins := c.scope().instructions
+	op := code.Opcode(ins[position])
+	def, _ := code.Lookup(byte(op))
+
+	operands, _ := code.ReadOperands(def, ins[position+1:])
+	operands[i] = operand
+	c.checkOperands(op, operands...)
+	copy(ins[position:], code.Make(op, operands...))
+}
+
+// checkOperands keeps the first operand too large for its instruction, like a
+// jump past 65535 bytes of code, code.Make would silently truncate it.
+func (c *Compiler) checkOperands(op code.Opcode, operands ...int) {
+	if err := code.CheckOperands(op, operands...); err != nil && c.operandError == nil {
+		c.operandError = err
+	}
+}
+
+func (c *Compiler) scope() *CompilationScope {
+	return c.scopes[len(c.scopes)-1]
+}
+
+func (c *Compiler) enterScope() {
+	c.scopes = append(c.scopes, &CompilationScope{names: make(map[int]string)})
+	c.symbolTable = NewEnclosedSymbolTable(c.symbolTable)
+}
+
+func (c *Compiler) leaveScope() *CompilationScope {
+	scope := c.scope()
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	c.symbolTable = c.symbolTable.Outer
+	return scope
+}
@@ -0,0 +1,252 @@
+package compiler
+
+import (
+	"go-interpreter/code"
+	"go-interpreter/lexer"
+	"go-interpreter/object"
+	"go-interpreter/parser"
+	"strings"
+	"testing"
+)
+
+type compilerTestCase struct {
+	input                string
+	expectedConstants    []interface{}
+	expectedInstructions []code.Instructions
+}
+
+func TestIntegerArithmetic(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "1 + 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpReturnValue),
+			},
+		},
+		{
+			input:             "1; -2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpMinus),
+				code.Make(code.OpReturnValue),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestConditionals(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "if (true) { 10 }; 3333;",
+			expectedConstants: []interface{}{10, 3333},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 10),
+				// 0004
+				code.Make(code.OpConstant, 0),
+				// 0007
+				code.Make(code.OpJump, 11),
+				// 0010
+				code.Make(code.OpNull),
+				// 0011
+				code.Make(code.OpPop),
+				// 0012
+				code.Make(code.OpConstant, 1),
+				// 0015
+				code.Make(code.OpReturnValue),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestGlobalVarStatements(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "var one = 1; one += 2; var two = one",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpDefineGlobal, 0),
+				code.Make(code.OpCheckGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpAssignGlobal, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpDefineGlobal, 1),
+				code.Make(code.OpReturn),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestClosures(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: "fun(a) { fun(b) { a + b } }",
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetFree, 1, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpAdd),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpClosure, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1),
+				code.Make(code.OpReturnValue),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestOperandOverflow(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{
+			"if (true) { " + strings.Repeat("1; ", 20000) + "}",
+			"operand 80006 of OpJumpNotTruthy does not fit in 2 bytes",
+		},
+		{
+			"fun(a) { " + strings.Repeat("fun() { ", 256) + "a" + strings.Repeat(" }", 257),
+			"operand 256 of OpGetFree does not fit in 1 bytes",
+		},
+	}
+
+	for _, tt := range tests {
+		err := New().Compile(parser.New(lexer.New(tt.input)).ParseProgram())
+		if err == nil {
+			t.Errorf("expected compile error for %.20q", tt.input)
+			continue
+		}
+		if err.Error() != tt.expectedMessage {
+			t.Errorf("wrong error message, got=%q, want=%q", err.Error(), tt.expectedMessage)
+		}
+	}
+}
+
+func TestSymbolTableScopes(t *testing.T) {
+	global := NewSymbolTable()
+	a := global.Define("a")
+
+	local := NewEnclosedSymbolTable(global)
+	b := local.Define("b")
+
+	block := NewBlockSymbolTable(local)
+	c := block.Define("c")
+
+	inner := NewEnclosedSymbolTable(block)
+
+	tests := []struct {
+		table    *SymbolTable
+		name     string
+		expected Symbol
+	}{
+		{local, "a", Symbol{Name: "a", Scope: GlobalScope, Index: 0}},
+		{local, "b", Symbol{Name: "b", Scope: LocalScope, Index: 0}},
+		{block, "b", Symbol{Name: "b", Scope: LocalScope, Index: 0}},
+		{block, "c", Symbol{Name: "c", Scope: LocalScope, Index: 1}},
+		{inner, "a", Symbol{Name: "a", Scope: GlobalScope, Index: 0}},
+		{inner, "c", Symbol{Name: "c", Scope: FreeScope, Index: 1, Depth: 1}},
+	}
+
+	for _, tt := range tests {
+		symbol, ok := tt.table.Resolve(tt.name)
+		if !ok {
+			t.Errorf("name %s not resolvable", tt.name)
+			continue
+		}
+		if symbol != tt.expected {
+			t.Errorf("expected %s to resolve to %+v, got=%+v", tt.name, tt.expected, symbol)
+		}
+	}
+
+	if a.Index != 0 || b.Index != 0 || c.Index != 1 {
+		t.Errorf("wrong slots, a=%d b=%d c=%d", a.Index, b.Index, c.Index)
+	}
+	if local.NumDefinitions() != 2 {
+		t.Errorf("block definitions not counted by the function, got=%d", local.NumDefinitions())
+	}
+	if _, ok := local.Resolve("c"); ok {
+		t.Errorf("block definition visible outside the block")
+	}
+}
+
+func runCompilerTests(t *testing.T, tests []compilerTestCase) {
+	t.Helper()
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+
+		compiler := New()
+		if err := compiler.Compile(program); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		bytecode := compiler.Bytecode()
+		testInstructions(t, tt.expectedInstructions, bytecode.Main.Instructions)
+		testConstants(t, tt.expectedConstants, bytecode.Constants)
+	}
+}
+
+func testInstructions(t *testing.T, expected []code.Instructions, actual code.Instructions) {
+	t.Helper()
+
+	concatted := code.Instructions{}
+	for _, ins := range expected {
+		concatted = append(concatted, ins...)
+	}
+
+	if concatted.String() != actual.String() {
+		t.Errorf("wrong instructions.\nwant=\n%s\ngot=\n%s", concatted, actual)
+	}
+}
+
+func testConstants(t *testing.T, expected []interface{}, actual []object.Object) {
+	t.Helper()
+
+	if len(expected) != len(actual) {
+		t.Fatalf("wrong number of constants. got=%d, want=%d", len(actual), len(expected))
+	}
+
+	for i, constant := range expected {
+		switch constant := constant.(type) {
+		case int:
+			integer, ok := actual[i].(*object.Integer)
+			if !ok || integer.Value != int64(constant) {
+				t.Errorf("constant %d is not %d. got=%s", i, constant, actual[i].Inspect())
+			}
+		case []code.Instructions:
+			fn, ok := actual[i].(*object.CompiledFunction)
+			if !ok {
+				t.Errorf("constant %d is not a function. got=%T", i, actual[i])
+				continue
+			}
+			testInstructions(t, constant, fn.Instructions)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package compiler
+
+type SymbolScope string
+
+const (
+	GlobalScope SymbolScope = "GLOBAL"
+	LocalScope  SymbolScope = "LOCAL"
+	FreeScope   SymbolScope = "FREE"
+)
+
+// Symbol is a resolved variable. Free symbols live Depth functions out from
+// the one using them.
+type Symbol struct {
+	Name  string
+	Scope SymbolScope
+	Index int
+	Depth int
+}
+
+// SymbolTable maps names to slots. Every function gets its own table; block
+// tables, like the one for a catch parameter, hide names for a while but take
+// their slots from the function around them.
+type SymbolTable struct {
+	Outer *SymbolTable
+
+	store map[string]Symbol
+	// owner is the table whose slots definitions use: the table itself unless it is a block
+	owner *SymbolTable
+	names []string
+}
+
+func NewSymbolTable() *SymbolTable {
+	s := &SymbolTable{store: make(map[string]Symbol)}
+	s.owner = s
+	return s
+}
+
+func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewSymbolTable()
+	s.Outer = outer
+	return s
+}
+
+func NewBlockSymbolTable(outer *SymbolTable) *SymbolTable {
+	return &SymbolTable{Outer: outer, store: make(map[string]Symbol), owner: outer.owner}
+}
+
+// Define declares name in this table, a name defined twice keeps its slot.
+func (s *SymbolTable) Define(name string) Symbol {
+	if symbol, ok := s.store[name]; ok {
+		return symbol
+	}
+
+	symbol := Symbol{Name: name, Scope: LocalScope, Index: len(s.owner.names)}
+	if s.owner.Outer == nil {
+		symbol.Scope = GlobalScope
+	}
+
+	s.owner.names = append(s.owner.names, name)
+	s.store[name] = symbol
+	return symbol
+}
+
+func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
+	depth := 0
+	for table := s; table != nil; table = table.Outer {
+		if symbol, ok := table.store[name]; ok {
+			if symbol.Scope != GlobalScope && depth > 0 {
+				symbol.Scope = FreeScope
+				symbol.Depth = depth
+			}
+			return symbol, true
+		}
+
+		if table.owner == table {
+			depth++
+		}
+	}
+	return Symbol{}, false
+}
+
+// Global returns the outermost table.
+func (s *SymbolTable) Global() *SymbolTable {
+	table := s
+	for table.Outer != nil {
+		table = table.Outer
+	}
+	return table
+}
+
+// Names lists the names of the slots owned by this table, by index.
+func (s *SymbolTable) Names() []string {
+	return s.owner.names
+}
+
+// NumDefinitions is the number of slots owned by this table.
+func (s *SymbolTable) NumDefinitions() int {
+	return len(s.owner.names)
+}
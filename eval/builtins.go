@@ -1,6 +1,9 @@
 package eval
 
-import "go-interpreter/object"
+import (
+	"go-interpreter/object"
+	"unicode/utf8"
+)
 
 var builtins = map[string]*object.Builtin{
 	"len": {
@@ -11,9 +14,11 @@ var builtins = map[string]*object.Builtin{
 
 			switch arg := args[0].(type) {
 			case *object.String:
-				return &object.Integer{Value: int64(len(arg.Value))}
+				return &object.Integer{Value: int64(utf8.RuneCountInString(arg.Value))}
 			case *object.Array:
 				return &object.Integer{Value: int64(len(arg.Elements))}
+			case *object.Hash:
+				return &object.Integer{Value: int64(len(arg.Keys))}
 			default:
 				return newError("argument to `len` not supported, got %s", args[0].Type())
 			}
@@ -29,7 +34,8 @@ var builtins = map[string]*object.Builtin{
 				if len(arg.Value) == 0 {
 					return NULL
 				}
-				return &object.String{Value: string(arg.Value[0])}
+				r, _ := utf8.DecodeRuneInString(arg.Value)
+				return &object.String{Value: string(r)}
 			case *object.Array:
 				if len(arg.Elements) == 0 {
 					return NULL
@@ -50,7 +56,8 @@ var builtins = map[string]*object.Builtin{
 				if len(arg.Value) == 0 {
 					return NULL
 				}
-				return &object.String{Value: string(arg.Value[1:len(arg.Value)])}
+				_, width := utf8.DecodeRuneInString(arg.Value)
+				return &object.String{Value: arg.Value[width:]}
 			case *object.Array:
 				length := len(arg.Elements)
 				if length == 0 {
@@ -71,11 +78,11 @@ var builtins = map[string]*object.Builtin{
 			}
 			switch arg := args[0].(type) {
 			case *object.String:
-				length := len(arg.Value)
-				if length == 0 {
+				if len(arg.Value) == 0 {
 					return NULL
 				}
-				return &object.String{Value: string(arg.Value[length-1])}
+				r, _ := utf8.DecodeLastRuneInString(arg.Value)
+				return &object.String{Value: string(r)}
 			case *object.Array:
 				length := len(arg.Elements)
 				if length == 0 {
@@ -107,6 +114,79 @@ var builtins = map[string]*object.Builtin{
 			}
 		},
 	},
+	"keys": {
+		Fun: func(args ...object.Object) object.Object {
+			if err := checkArgsLen(1, args...); err != nil {
+				return err
+			}
+			hash, ok := args[0].(*object.Hash)
+			if !ok {
+				return newError("argument to `keys` must be Hash, got %s", args[0].Type())
+			}
+			keys := make([]object.Object, 0, len(hash.Keys))
+			for _, pair := range hash.Ordered() {
+				keys = append(keys, pair.Key)
+			}
+			return &object.Array{Elements: keys}
+		},
+	},
+	"values": {
+		Fun: func(args ...object.Object) object.Object {
+			if err := checkArgsLen(1, args...); err != nil {
+				return err
+			}
+			hash, ok := args[0].(*object.Hash)
+			if !ok {
+				return newError("argument to `values` must be Hash, got %s", args[0].Type())
+			}
+			values := make([]object.Object, 0, len(hash.Keys))
+			for _, pair := range hash.Ordered() {
+				values = append(values, pair.Value)
+			}
+			return &object.Array{Elements: values}
+		},
+	},
+	"has": {
+		Fun: func(args ...object.Object) object.Object {
+			if err := checkArgsLen(2, args...); err != nil {
+				return err
+			}
+			hash, ok := args[0].(*object.Hash)
+			if !ok {
+				return newError("argument to `has` must be Hash, got %s", args[0].Type())
+			}
+			key, ok := args[1].(object.Hashable)
+			if !ok {
+				return newError("unusable as hash key: %s", args[1].Type())
+			}
+			_, found := hash.Get(key)
+			return booleanFromNativeBool(found)
+		},
+	},
+	"delete": {
+		Fun: func(args ...object.Object) object.Object {
+			if err := checkArgsLen(2, args...); err != nil {
+				return err
+			}
+			hash, ok := args[0].(*object.Hash)
+			if !ok {
+				return newError("argument to `delete` must be Hash, got %s", args[0].Type())
+			}
+			key, ok := args[1].(object.Hashable)
+			if !ok {
+				return newError("unusable as hash key: %s", args[1].Type())
+			}
+			// like push, delete leaves its argument untouched and returns a new Hash
+			deleted := key.HashKey()
+			newHash := object.NewHash()
+			for _, pair := range hash.Ordered() {
+				if pair.Key.(object.Hashable).HashKey() != deleted {
+					newHash.Set(pair.Key.(object.Hashable), pair.Value)
+				}
+			}
+			return newHash
+		},
+	},
 }
 
 func checkArgsLen(argsLen int, args ...object.Object) *object.Error {
@@ -4,23 +4,50 @@ import (
 	"fmt"
 	"go-interpreter/ast"
 	"go-interpreter/object"
+	"go-interpreter/token"
+	"math"
+	"strings"
 )
 
 var (
-	TRUE  = &object.Boolean{Value: true}
-	FALSE = &object.Boolean{Value: false}
-	NULL  = &object.Null{}
+	TRUE     = &object.Boolean{Value: true}
+	FALSE    = &object.Boolean{Value: false}
+	NULL     = &object.Null{}
+	BREAK    = &object.Break{}
+	CONTINUE = &object.Continue{}
 )
 
 func Eval(node ast.Node, env *object.Environment) object.Object {
+	var result object.Object
+	if env.Meter == nil {
+		result = evalNode(node, env)
+	} else {
+		result = evalMetered(node, env)
+	}
+
+	// the innermost node that produced an error is the most precise location we have
+	if err, ok := result.(*object.Error); ok && !err.Pos.IsValid() && node != nil {
+		err.Pos = node.Pos()
+	}
+	return result
+}
+
+func evalNode(node ast.Node, env *object.Environment) object.Object {
 	switch node := node.(type) {
 	case *ast.Program:
 		return evalProgram(node, env)
 	case *ast.ExpressionStatement:
+		if ifExpression, ok := node.Value.(*ast.IfExpression); ok {
+			// only here can a return in a branch hand its tail call to the caller
+			return evalIfExpression(ifExpression, env)
+		}
 		return Eval(node.Value, env)
 	case *ast.BlockStatement:
 		return evalBlockStatement(node.Statements, env)
 	case *ast.ReturnStatement:
+		if call, ok := node.ReturnValue.(*ast.CallExpression); ok {
+			return evalTailCall(call, env)
+		}
 		val := Eval(node.ReturnValue, env)
 		if isError(val) {
 			return val
@@ -31,13 +58,31 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		if isError(val) {
 			return val
 		}
-		env.Set(node.Name.Value, val)
+		bind(env, node.Name, val)
+		return NULL
+	case *ast.WhileStatement:
+		return evalWhileStatement(node, env)
+	case *ast.ForStatement:
+		return evalForStatement(node, env)
+	case *ast.ForInStatement:
+		return evalForInStatement(node, env)
+	case *ast.ThrowStatement:
+		return evalThrowStatement(node, env)
+	case *ast.TryStatement:
+		return evalTryStatement(node, env)
+	case *ast.BreakStatement:
+		return BREAK
+	case *ast.ContinueStatement:
+		return CONTINUE
 	case *ast.Identifier:
 		return evalIdentifier(node, env)
 	case *ast.FunctionLiteral:
-		params := node.Parameters
-		body := node.Body
-		return &object.Function{Parameters: params, Body: body, Env: env}
+		return newFunction(node, env)
+	case *ast.FunctionStatement:
+		// already bound by hoistFunctions when the enclosing block started
+		return NULL
+	case *ast.SpreadExpression:
+		return newError("spread is only allowed in call arguments and array literals")
 	case *ast.PrefixExpression:
 		right := Eval(node.Right, env)
 		if isError(right) {
@@ -45,6 +90,10 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		}
 		return evalPrefixExpression(node.Operator, right)
 	case *ast.InfixExpression:
+		if node.Operator == "&&" || node.Operator == "||" {
+			return evalLogicalExpression(node, env)
+		}
+
 		left := Eval(node.Left, env)
 		if isError(left) {
 			return left
@@ -55,18 +104,20 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 			return right
 		}
 		return evalInfixExpression(node.Operator, left, right)
+	case *ast.AssignExpression:
+		return evalAssignExpression(node, env)
 	case *ast.IndexExpression:
 		left := Eval(node.Left, env)
 		if isError(left) {
 			return left
 		}
 		index := Eval(node.Index, env)
-		if isError(left) {
-			return left
+		if isError(index) {
+			return index
 		}
 		return evalIndexExpression(left, index)
 	case *ast.IfExpression:
-		return evalIfExpression(node, env)
+		return finishTailCall(evalIfExpression(node, env), env)
 	case *ast.CallExpression:
 		function := Eval(node.Function, env)
 		if isError(function) {
@@ -76,9 +127,11 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		if len(args) == 1 && isError(args[0]) {
 			return args[0]
 		}
-		return applyFunction(function, args)
+		return applyFunction(env, calleeName(node.Function, function), node.Pos(), function, args)
 	case *ast.IntegerLiteral:
 		return &object.Integer{Value: node.Value}
+	case *ast.FloatLiteral:
+		return &object.Float{Value: node.Value}
 	case *ast.Boolean:
 		return booleanFromNativeBool(node.Value)
 	case *ast.StringLiteral:
@@ -89,10 +142,11 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 			return elements[0]
 		}
 		return &object.Array{Elements: elements}
+	case *ast.HashLiteral:
+		return evalHashLiteral(node, env)
 	default:
 		return newError("invalid node: %s", node.String())
 	}
-	return nil
 }
 
 func isError(obj object.Object) bool {
@@ -103,11 +157,41 @@ func isError(obj object.Object) bool {
 	return false
 }
 
+// SafeEval is Eval for hosts that must outlive the script, like the REPL. A Go
+// panic while evaluating is turned into an Error at the top-level statement that
+// caused it, instead of taking the whole process down.
+func SafeEval(node ast.Node, env *object.Environment) object.Object {
+	if program, ok := node.(*ast.Program); ok {
+		return evalProgramWith(program, env, safeEvalStatement)
+	}
+	return safeEvalStatement(node, env)
+}
+
+func safeEvalStatement(node ast.Node, env *object.Environment) (result object.Object) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = &object.Error{Kind: object.RUNTIME_ERROR, Message: fmt.Sprintf("internal error: %v", r), Pos: node.Pos()}
+		}
+	}()
+	return finishTailCall(Eval(node, env), env)
+}
+
 func evalProgram(program *ast.Program, env *object.Environment) object.Object {
+	return evalProgramWith(program, env, evalStatement)
+}
+
+// evalStatement evaluates a top-level statement, where a tail call has no call to replace.
+func evalStatement(node ast.Node, env *object.Environment) object.Object {
+	return finishTailCall(Eval(node, env), env)
+}
+
+func evalProgramWith(program *ast.Program, env *object.Environment, eval func(ast.Node, *object.Environment) object.Object) object.Object {
 	var result object.Object
 
+	hoistFunctions(program.Statements, env)
+
 	for _, statement := range program.Statements {
-		result = Eval(statement, env)
+		result = eval(statement, env)
 
 		switch result := result.(type) {
 		case *object.ReturnValue:
@@ -117,32 +201,165 @@ func evalProgram(program *ast.Program, env *object.Environment) object.Object {
 		}
 	}
 
+	// declarations are null inside functions, a program ending in one has no value
+	if len(program.Statements) > 0 && isDeclaration(program.Statements[len(program.Statements)-1]) {
+		return nil
+	}
 	return result
 }
 
+func isDeclaration(statement ast.Statement) bool {
+	switch statement.(type) {
+	case *ast.VarStatement, *ast.FunctionStatement:
+		return true
+	default:
+		return false
+	}
+}
+
 func evalBlockStatement(statements []ast.Statement, env *object.Environment) object.Object {
 	var result object.Object
 
+	hoistFunctions(statements, env)
+
 	for _, statement := range statements {
 		result = Eval(statement, env)
 
-		if isError(result) {
+		switch result.(type) {
+		case *object.ReturnValue, *object.Error, *object.Break, *object.Continue:
 			return result
 		}
+	}
+
+	return result
+}
+
+// evalThrowStatement raises the thrown value as an error. Throwing a hash, such as
+// a caught error, takes the message and type from its "message" and "type" entries.
+func evalThrowStatement(node *ast.ThrowStatement, env *object.Environment) object.Object {
+	value := Eval(node.Value, env)
+	if isError(value) {
+		return value
+	}
+	return thrownError(value)
+}
+
+func thrownError(value object.Object) *object.Error {
+	thrown := &object.Error{Kind: object.THROWN_ERROR, Message: value.Inspect()}
+	if hash, ok := value.(*object.Hash); ok {
+		if message, ok := hash.Get(&object.String{Value: "message"}); ok {
+			thrown.Message = message.Inspect()
+		}
+		if kind, ok := hash.Get(&object.String{Value: "type"}); ok {
+			thrown.Kind = kind.Inspect()
+		}
+		if hash.Caught != nil {
+			thrown.Pos = hash.Caught.Pos
+			thrown.Stack = append([]object.Frame(nil), hash.Caught.Stack...)
+		}
+	}
+	return thrown
+}
+
+func evalTryStatement(node *ast.TryStatement, env *object.Environment) object.Object {
+	// tail calls have to happen within the try statement to be caught
+	result := finishTailCall(Eval(node.Block, env), env)
 
-		if result.Type() == object.RETURN_VALUE_OBJECT || result.Type() == object.ERROR_OBJECT {
+	// running out of budget ends the evaluation, nothing may catch it or run after it
+	if isLimitError(result) {
+		return result
+	}
+
+	if err, ok := result.(*object.Error); ok && node.Catch != nil {
+		catchEnv := object.NewSlotEnvironment(env, node.CatchSlots)
+		bind(catchEnv, node.Param, caughtError(err))
+		result = finishTailCall(Eval(node.Catch, catchEnv), env)
+		if isLimitError(result) {
 			return result
 		}
 	}
 
+	if node.Finally != nil {
+		// errors and control flow leaving the finally block replace the pending result
+		switch finally := Eval(node.Finally, env).(type) {
+		case *object.Error, *object.ReturnValue, *object.Break, *object.Continue:
+			return finally
+		}
+	}
+
 	return result
 }
 
+// caughtError is the value a catch block sees: a hash holding the error's
+// "message", "type" and "stack", innermost call first. Throwing it again
+// rethrows err from where it happened.
+func caughtError(err *object.Error) *object.Hash {
+	kind := err.Kind
+	if kind == "" {
+		kind = object.RUNTIME_ERROR
+	}
+
+	stack := make([]object.Object, 0, len(err.Stack))
+	for _, frame := range err.Stack {
+		stack = append(stack, &object.String{Value: frame.String()})
+	}
+
+	caught := object.NewHash()
+	caught.Set(&object.String{Value: "message"}, &object.String{Value: err.Message})
+	caught.Set(&object.String{Value: "type"}, &object.String{Value: kind})
+	caught.Set(&object.String{Value: "stack"}, &object.Array{Elements: stack})
+	caught.Caught = err
+	return caught
+}
+
+// hoistFunctions binds every function declared in a block before the block runs,
+// so declarations can call each other regardless of their order.
+func hoistFunctions(statements []ast.Statement, env *object.Environment) {
+	for _, statement := range statements {
+		if declaration, ok := statement.(*ast.FunctionStatement); ok {
+			bind(env, declaration.Name, newFunction(declaration.Function, env))
+		}
+	}
+}
+
+func newFunction(node *ast.FunctionLiteral, env *object.Environment) *object.Function {
+	return &object.Function{
+		Name:       node.Name,
+		Parameters: node.Parameters,
+		Defaults:   node.Defaults,
+		Rest:       node.Rest,
+		Body:       node.Body,
+		Env:        env,
+		Slots:      node.Slots,
+	}
+}
+
+// bind declares the variable identifier names in env, in its slot when it has one.
+func bind(env *object.Environment, identifier *ast.Identifier, value object.Object) {
+	if identifier.Resolved {
+		env.SetAt(identifier.Depth, identifier.Slot, value)
+		return
+	}
+	env.Set(identifier.Value, value)
+}
+
+// lookup finds the variable identifier names, in its slot when it has one.
+func lookup(env *object.Environment, identifier *ast.Identifier) (object.Object, bool) {
+	if identifier.Resolved {
+		value := env.GetAt(identifier.Depth, identifier.Slot)
+		return value, value != nil
+	}
+	return env.Get(identifier.Value)
+}
+
 func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object {
-	value, ok := env.Get(node.Value)
+	value, ok := lookup(env, node)
 	if ok {
 		return value
 	}
+	if node.Resolved {
+		return newError("identifier not found: %s", node.Value)
+	}
 
 	if builtin, ok := builtins[node.Value]; ok {
 		return builtin
@@ -151,12 +368,40 @@ func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object
 	return newError("identifier not found: %s", node.Value)
 }
 
+func evalAssignExpression(node *ast.AssignExpression, env *object.Environment) object.Object {
+	current, ok := lookup(env, node.Name)
+	if !ok {
+		return newError("assignment to undeclared variable: %s", node.Name.Value)
+	}
+
+	value := Eval(node.Value, env)
+	if isError(value) {
+		return value
+	}
+
+	if node.Operator != "=" {
+		value = evalInfixExpression(strings.TrimSuffix(node.Operator, "="), current, value)
+		if isError(value) {
+			return value
+		}
+	}
+
+	if node.Name.Resolved {
+		env.SetAt(node.Name.Depth, node.Name.Slot, value)
+	} else {
+		env.Assign(node.Name.Value, value)
+	}
+	return value
+}
+
 func evalPrefixExpression(operator string, right object.Object) object.Object {
 	switch operator {
 	case "!":
 		return evalBangOperatorExpression(right)
 	case "-":
 		return evalMinusPrefixOperatorExpression(right)
+	case "~":
+		return evalTildePrefixOperatorExpression(right)
 	default:
 		return newError("unknown operator: %s", operator)
 	}
@@ -172,15 +417,30 @@ func evalBangOperatorExpression(right object.Object) object.Object {
 }
 
 func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
-	if right.Type() != object.INTEGER_OBJECT {
+	switch right := right.(type) {
+	case *object.Integer:
+		return &object.Integer{Value: -right.Value}
+	case *object.Float:
+		return &object.Float{Value: -right.Value}
+	default:
 		return newError("invalid usage of `-` operator: -%s", right.Type())
 	}
+}
 
-	value := right.(*object.Integer).Value
-	return &object.Integer{Value: -value}
+func evalTildePrefixOperatorExpression(right object.Object) object.Object {
+	integer, ok := right.(*object.Integer)
+	if !ok {
+		return newError("invalid usage of `~` operator: ~%s", right.Type())
+	}
+	return &object.Integer{Value: ^integer.Value}
 }
 
 func evalInfixExpression(operator string, left object.Object, right object.Object) object.Object {
+	// an Integer meeting a Float is promoted, so `1 + 0.5` is a Float
+	if isNumber(left) && isNumber(right) && (left.Type() == object.FLOAT_OBJECT || right.Type() == object.FLOAT_OBJECT) {
+		return evalFloatInfixExpression(operator, left, right)
+	}
+
 	if left.Type() != right.Type() {
 		return newError("type mismatch: %s %s %s", left.Type(), operator, right.Type())
 	}
@@ -197,6 +457,28 @@ func evalInfixExpression(operator string, left object.Object, right object.Objec
 	}
 }
 
+// evalLogicalExpression only evaluates the right side when the left one doesn't
+// decide the result. Like `if`, it treats everything except `true` as false.
+func evalLogicalExpression(node *ast.InfixExpression, env *object.Environment) object.Object {
+	left := Eval(node.Left, env)
+	if isError(left) {
+		return left
+	}
+
+	switch {
+	case node.Operator == "&&" && !isTruthy(left):
+		return FALSE
+	case node.Operator == "||" && isTruthy(left):
+		return TRUE
+	}
+
+	right := Eval(node.Right, env)
+	if isError(right) {
+		return right
+	}
+	return booleanFromNativeBool(isTruthy(right))
+}
+
 func evalIntegerInfixExpression(operator string, left object.Object, right object.Object) object.Object {
 	leftValue := left.(*object.Integer).Value
 	rightValue := right.(*object.Integer).Value
@@ -209,7 +491,40 @@ func evalIntegerInfixExpression(operator string, left object.Object, right objec
 	case "*":
 		return &object.Integer{Value: leftValue * rightValue}
 	case "/":
+		if rightValue == 0 {
+			return newError("division by zero: %d / 0", leftValue)
+		}
+		if leftValue == math.MinInt64 && rightValue == -1 {
+			return newError("integer overflow: %d / -1", leftValue)
+		}
 		return &object.Integer{Value: leftValue / rightValue}
+	case "%":
+		if rightValue == 0 {
+			return newError("division by zero: %d %% 0", leftValue)
+		}
+		return &object.Integer{Value: leftValue % rightValue}
+	case "**":
+		if rightValue < 0 {
+			return newError("negative exponent: %d ** %d", leftValue, rightValue)
+		}
+		return &object.Integer{Value: integerPower(leftValue, rightValue)}
+
+	case "&":
+		return &object.Integer{Value: leftValue & rightValue}
+	case "|":
+		return &object.Integer{Value: leftValue | rightValue}
+	case "^":
+		return &object.Integer{Value: leftValue ^ rightValue}
+	case "<<":
+		if rightValue < 0 {
+			return newError("negative shift count: %d << %d", leftValue, rightValue)
+		}
+		return &object.Integer{Value: leftValue << rightValue}
+	case ">>":
+		if rightValue < 0 {
+			return newError("negative shift count: %d >> %d", leftValue, rightValue)
+		}
+		return &object.Integer{Value: leftValue >> rightValue}
 
 	case "<":
 		return booleanFromNativeBool(leftValue < rightValue)
@@ -228,6 +543,70 @@ func evalIntegerInfixExpression(operator string, left object.Object, right objec
 	}
 }
 
+// integerPower squares and multiplies, so like `+` and `*` it wraps around on
+// overflow instead of failing.
+func integerPower(base int64, exponent int64) int64 {
+	result := int64(1)
+	for exponent > 0 {
+		if exponent&1 == 1 {
+			result *= base
+		}
+		base *= base
+		exponent >>= 1
+	}
+	return result
+}
+
+func evalFloatInfixExpression(operator string, left object.Object, right object.Object) object.Object {
+	leftValue := toFloat(left)
+	rightValue := toFloat(right)
+
+	switch operator {
+	case "+":
+		return &object.Float{Value: leftValue + rightValue}
+	case "-":
+		return &object.Float{Value: leftValue - rightValue}
+	case "*":
+		return &object.Float{Value: leftValue * rightValue}
+	case "/":
+		return &object.Float{Value: leftValue / rightValue}
+	case "%":
+		return &object.Float{Value: math.Mod(leftValue, rightValue)}
+	case "**":
+		return &object.Float{Value: math.Pow(leftValue, rightValue)}
+
+	case "<":
+		return booleanFromNativeBool(leftValue < rightValue)
+	case "<=":
+		return booleanFromNativeBool(leftValue <= rightValue)
+	case ">":
+		return booleanFromNativeBool(leftValue > rightValue)
+	case ">=":
+		return booleanFromNativeBool(leftValue >= rightValue)
+	case "==":
+		return booleanFromNativeBool(leftValue == rightValue)
+	case "!=":
+		return booleanFromNativeBool(leftValue != rightValue)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+func isNumber(obj object.Object) bool {
+	return obj.Type() == object.INTEGER_OBJECT || obj.Type() == object.FLOAT_OBJECT
+}
+
+func toFloat(obj object.Object) float64 {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return float64(obj.Value)
+	case *object.Float:
+		return obj.Value
+	default:
+		return 0
+	}
+}
+
 func evalBooleanInfixExpression(operator string, left object.Object, right object.Object) object.Object {
 	leftValue := left.(*object.Boolean).Value
 	rightValue := right.(*object.Boolean).Value
@@ -264,7 +643,7 @@ func evalIfExpression(node *ast.IfExpression, env *object.Environment) object.Ob
 		return condition
 	}
 
-	if condition == TRUE {
+	if isTruthy(condition) {
 		return Eval(node.Consequence, env)
 	}
 
@@ -276,6 +655,116 @@ func evalIfExpression(node *ast.IfExpression, env *object.Environment) object.Ob
 	return NULL
 }
 
+// isTruthy follows the language rule that only `true` is truthy.
+func isTruthy(obj object.Object) bool {
+	return obj == TRUE
+}
+
+// evalLoopBody runs one iteration. It reports whether the loop should stop and,
+// if so, the object the loop statement evaluates to.
+func evalLoopBody(body *ast.BlockStatement, env *object.Environment) (object.Object, bool) {
+	result := Eval(body, env)
+
+	switch result.(type) {
+	case *object.Break:
+		return NULL, true
+	case *object.ReturnValue, *object.Error:
+		return result, true
+	default:
+		return nil, false
+	}
+}
+
+func evalWhileStatement(node *ast.WhileStatement, env *object.Environment) object.Object {
+	for {
+		condition := Eval(node.Condition, env)
+		if isError(condition) {
+			return condition
+		}
+		if !isTruthy(condition) {
+			return NULL
+		}
+
+		if result, done := evalLoopBody(node.Body, env); done {
+			return result
+		}
+	}
+}
+
+func evalForStatement(node *ast.ForStatement, env *object.Environment) object.Object {
+	if node.Init != nil {
+		init := Eval(node.Init, env)
+		if isError(init) {
+			return init
+		}
+	}
+
+	for {
+		if node.Condition != nil {
+			condition := Eval(node.Condition, env)
+			if isError(condition) {
+				return condition
+			}
+			if !isTruthy(condition) {
+				return NULL
+			}
+		}
+
+		if result, done := evalLoopBody(node.Body, env); done {
+			return result
+		}
+
+		if node.Step != nil {
+			step := Eval(node.Step, env)
+			if isError(step) {
+				return step
+			}
+		}
+	}
+}
+
+func evalForInStatement(node *ast.ForInStatement, env *object.Environment) object.Object {
+	iterable := Eval(node.Iterable, env)
+	if isError(iterable) {
+		return iterable
+	}
+
+	items, err := iterationItems(iterable)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		bind(env, node.Variable, item)
+		if result, done := evalLoopBody(node.Body, env); done {
+			return result
+		}
+	}
+
+	return NULL
+}
+
+// iterationItems lists what `for (x in iterable)` visits: array elements,
+// the characters of a string or the keys of a hash.
+func iterationItems(iterable object.Object) ([]object.Object, *object.Error) {
+	var items []object.Object
+	switch iterable := iterable.(type) {
+	case *object.Array:
+		items = iterable.Elements
+	case *object.String:
+		for _, r := range iterable.Value {
+			items = append(items, &object.String{Value: string(r)})
+		}
+	case *object.Hash:
+		for _, pair := range iterable.Ordered() {
+			items = append(items, pair.Key)
+		}
+	default:
+		return nil, newError("cannot iterate over %s", iterable.Type())
+	}
+	return items, nil
+}
+
 func booleanFromNativeBool(value bool) object.Object {
 	switch value {
 	case true:
@@ -286,40 +775,198 @@ func booleanFromNativeBool(value bool) object.Object {
 }
 
 func newError(format string, a ...interface{}) *object.Error {
-	return &object.Error{Message: fmt.Sprintf(format, a...)}
+	return &object.Error{Kind: object.RUNTIME_ERROR, Message: fmt.Sprintf(format, a...)}
 }
 
 func evalExpressions(arguments []ast.Expression, env *object.Environment) []object.Object {
 	result := make([]object.Object, 0, len(arguments))
 	for _, expr := range arguments {
+		spread, isSpread := expr.(*ast.SpreadExpression)
+		if isSpread {
+			expr = spread.Value
+		}
+
 		evaluated := Eval(expr, env)
 		if isError(evaluated) {
 			return []object.Object{evaluated}
 		}
-		result = append(result, evaluated)
+
+		if !isSpread {
+			result = append(result, evaluated)
+			continue
+		}
+
+		arr, ok := evaluated.(*object.Array)
+		if !ok {
+			err := newError("cannot spread %s, expected Array", evaluated.Type())
+			err.Pos = spread.Pos()
+			return []object.Object{err}
+		}
+		result = append(result, arr.Elements...)
 	}
 	return result
 }
 
-func applyFunction(function object.Object, args []object.Object) object.Object {
-	switch fun := function.(type) {
-	case *object.Function:
-		innerEnv := extendFunctionEnv(fun, args)
-		evaluated := Eval(fun.Body, innerEnv)
-		return unwrapReturnValue(evaluated)
-	case *object.Builtin:
-		return fun.Fun(args...)
+// calleeName names the called function, preferring the name it was declared
+// with over the expression it was called through. Anonymous functions have no name.
+func calleeName(callee ast.Expression, function object.Object) string {
+	if fun, ok := function.(*object.Function); ok && fun.Name != "" {
+		return fun.Name
+	}
+	if identifier, ok := callee.(*ast.Identifier); ok {
+		return identifier.Value
+	}
+	return ""
+}
+
+// applyFunction calls function with args from env and, as a trampoline, the tail
+// calls it returns, each replacing the previous call in place of nesting on the
+// Go stack. Errors raised inside a user-defined function record the call in
+// their stack as they unwind.
+func applyFunction(env *object.Environment, name string, callSite token.Position, function object.Object, args []object.Object) object.Object {
+	meter := env.Meter
+	if meter != nil {
+		if err := meter.Enter(); err != nil {
+			return atCallSite(err, callSite)
+		}
+		defer meter.Leave()
+	}
+
+	for {
+		var result object.Object
+		switch fun := function.(type) {
+		case *object.Function:
+			if err := checkArity(name, fun, args); err != nil {
+				return atCallSite(err, callSite)
+			}
+			innerEnv, bindError := extendFunctionEnv(fun, args, meter)
+			result = bindError
+			if result == nil {
+				result = unwrapReturnValue(Eval(fun.Body, innerEnv))
+			}
+		case *object.Builtin:
+			result = fun.Fun(args...)
+			if meter != nil && !isError(result) {
+				if err := meter.Allocate(result); err != nil {
+					result = err
+				}
+			}
+			return atCallSite(result, callSite)
+		default:
+			return atCallSite(newError("not a function: %s", function.Type()), callSite)
+		}
+
+		if tail, ok := result.(*object.TailCall); ok {
+			name, callSite, function, args = tail.Name, tail.CallSite, tail.Function, tail.Args
+			continue
+		}
+
+		if errorObject, ok := result.(*object.Error); ok {
+			errorObject.Stack = append(errorObject.Stack, object.Frame{Function: name, CallSite: callSite})
+		}
+		return result
+	}
+}
+
+// atCallSite places an error the call itself caused, a tail call being made
+// away from the node that would otherwise give its position.
+func atCallSite(result object.Object, callSite token.Position) object.Object {
+	if err, ok := result.(*object.Error); ok && !err.Pos.IsValid() {
+		err.Pos = callSite
+	}
+	return result
+}
+
+// evalTailCall evaluates the function and arguments of `return f(...)`, leaving
+// the call to the trampoline in applyFunction.
+func evalTailCall(node *ast.CallExpression, env *object.Environment) object.Object {
+	function := Eval(node.Function, env)
+	if isError(function) {
+		return function
+	}
+	args := evalExpressions(node.Arguments, env)
+	if len(args) == 1 && isError(args[0]) {
+		return args[0]
+	}
+
+	return &object.ReturnValue{Value: &object.TailCall{
+		Function: function,
+		Args:     args,
+		Name:     calleeName(node.Function, function),
+		CallSite: node.Pos(),
+	}}
+}
+
+// finishTailCall makes the tail call result returns, if any, where the call
+// can't replace the current one.
+func finishTailCall(result object.Object, env *object.Environment) object.Object {
+	returnValue, ok := result.(*object.ReturnValue)
+	if !ok {
+		return result
+	}
+	tail, ok := returnValue.Value.(*object.TailCall)
+	if !ok {
+		return result
+	}
+
+	value := applyFunction(env, tail.Name, tail.CallSite, tail.Function, tail.Args)
+	if isError(value) {
+		return value
+	}
+	return &object.ReturnValue{Value: value}
+}
+
+func checkArity(name string, fun *object.Function, args []object.Object) *object.Error {
+	min, max := fun.Arity()
+	return arityError(name, min, max, len(args))
+}
+
+// arityError reports a call with got arguments to a function taking min to max
+// of them, or nil if the count is fine.
+func arityError(name string, min int, max int, got int) *object.Error {
+	if got >= min && (max == -1 || got <= max) {
+		return nil
+	}
+
+	description := object.Frame{Function: name}.Description()
+	switch {
+	case max == -1:
+		return newError("wrong number of arguments to %s, got=%d, want at least %d", description, got, min)
+	case min != max:
+		return newError("wrong number of arguments to %s, got=%d, want=%d to %d", description, got, min, max)
 	default:
-		return newError("not a function: %s", function.Type())
+		return newError("wrong number of arguments to %s, got=%d, want=%d", description, got, min)
 	}
 }
 
-func extendFunctionEnv(fun *object.Function, args []object.Object) *object.Environment {
-	env := object.NewInnerEnvironment(fun.Env)
+// extendFunctionEnv binds the arguments. Missing ones take their default value,
+// evaluated in the new environment so defaults can refer to earlier parameters.
+// The call is accounted to the caller's meter rather than to the one the
+// function was created under.
+func extendFunctionEnv(fun *object.Function, args []object.Object, meter object.Meter) (*object.Environment, object.Object) {
+	env := object.NewSlotEnvironment(fun.Env, fun.Slots)
+	env.Meter = meter
 	for idx, param := range fun.Parameters {
-		env.Set(param.Value, args[idx])
+		if idx < len(args) {
+			bind(env, param, args[idx])
+			continue
+		}
+
+		value := Eval(fun.Defaults[idx], env)
+		if isError(value) {
+			return nil, value
+		}
+		bind(env, param, value)
+	}
+
+	if fun.Rest != nil {
+		rest := []object.Object{}
+		if len(args) > len(fun.Parameters) {
+			rest = append(rest, args[len(fun.Parameters):]...)
+		}
+		bind(env, fun.Rest, &object.Array{Elements: rest})
 	}
-	return env
+	return env, nil
 }
 
 func unwrapReturnValue(obj object.Object) object.Object {
@@ -333,6 +980,8 @@ func evalIndexExpression(left object.Object, index object.Object) object.Object
 	switch {
 	case left.Type() == object.ARRAY_OBJECT && index.Type() == object.INTEGER_OBJECT:
 		return evalArrayIndexExpression(left, index)
+	case left.Type() == object.HASH_OBJECT:
+		return evalHashIndexExpression(left, index)
 	default:
 		return newError("index operator not supported: %s", left.Type())
 	}
@@ -348,3 +997,41 @@ func evalArrayIndexExpression(array object.Object, index object.Object) object.O
 
 	return arr.Elements[idx]
 }
+
+func evalHashIndexExpression(hash object.Object, index object.Object) object.Object {
+	key, ok := index.(object.Hashable)
+	if !ok {
+		return newError("unusable as hash key: %s", index.Type())
+	}
+
+	value, ok := hash.(*object.Hash).Get(key)
+	if !ok {
+		return NULL
+	}
+	return value
+}
+
+func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Object {
+	hash := object.NewHash()
+
+	for _, pair := range node.Pairs {
+		key := Eval(pair.Key, env)
+		if isError(key) {
+			return key
+		}
+
+		hashKey, ok := key.(object.Hashable)
+		if !ok {
+			return newError("unusable as hash key: %s", key.Type())
+		}
+
+		value := Eval(pair.Value, env)
+		if isError(value) {
+			return value
+		}
+
+		hash.Set(hashKey, value)
+	}
+
+	return hash
+}
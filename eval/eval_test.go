@@ -1,190 +1,60 @@
 package eval
 
 import (
+	"context"
+	"go-interpreter/internal/enginetest"
 	"go-interpreter/lexer"
 	"go-interpreter/object"
 	"go-interpreter/parser"
+	"go-interpreter/resolver"
 	"testing"
+	"time"
 )
 
-func TestEvalIntegerExpression(t *testing.T) {
-	tests := []struct {
-		input    string
-		expected int64
-	}{
-		{"420", 420},
-		{"69", 69},
-		{"420", 420},
-		{"-420", -420},
-		{"-69", -69},
-		{"--420", 420},
-		{"--69", 69},
-		{"5 + 5 + 5 + 5 - 10", 10},
-		{"2 * 2 * 2 * 2 * 2", 32},
-		{"-50 + 100 + -50", 0},
-		{"5 * 2 + 10", 20},
-		{"5 + 2 * 10", 25},
-		{"20 + 2 * -10", 0},
-		{"50 / 2 * 2 + 10", 60},
-		{"2 * (5 + 10)", 30},
-		{"3 * 3 * 3 + 10", 37},
-		{"3 * (3 * 3) + 10", 37},
-		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50}}
-
-	for _, tt := range tests {
-		evaluated := testEval(tt.input)
-		testIntegerObject(t, evaluated, tt.expected)
-	}
-}
-
-func TestEvalBooleanExpression(t *testing.T) {
-	tests := []struct {
-		input    string
-		expected bool
-	}{
-		{"true", true},
-		{"false", false},
-		{"1 < 2", true},
-		{"1 > 2", false},
-		{"1 < 1", false},
-		{"1 > 1", false},
-		{"1 == 1", true},
-		{"1 != 1", false},
-		{"1 == 2", false},
-		{"1 != 2", true},
-		{"1 <= 2", true},
-		{"1 >= 2", false},
-		{"true == true", true},
-		{"false == false", true},
-		{"true == false", false},
-		{"true != false", true},
-		{"false != true", true},
-		{"(1 < 2) == true", true},
-		{"(1 < 2) == false", false},
-		{"(1 > 2) == true", false},
-		{"(1 > 2) == false", true},
-		{`"nice" == "nice"`, true},
-		{`"hello" != "nice"`, true},
-		{`"hello" == "nice"`, false},
-	}
-
-	for _, tt := range tests {
-		evaluated := testEval(tt.input)
-		if !testBooleanObject(t, evaluated, tt.expected) {
-			t.Logf("<< %q", tt.input)
-		}
-	}
+func TestEngine(t *testing.T) {
+	enginetest.Run(t, func(input string) object.Object {
+		program := parser.New(lexer.New(input)).ParseProgram()
+		// undeclared names are left for Eval to report
+		resolver.Resolve(program, nil)
+		return Eval(program, object.NewEnvironment())
+	})
 }
 
-func TestEvalConditionsExpression(t *testing.T) {
-	tests := []struct {
-		input    string
-		expected interface{}
-	}{
-		{"if (true) { 10 }", 10},
-		{"if (false) { 10 }", nil},
-		{"if (1) { 10 }", nil}, // anything expect "true" is falsy
-		{"if (1 < 2) { 10 }", 10},
-		{"if (1 > 2) { 10 }", nil},
-		{"if (1 > 2) { 10 } else { 20 }", 20},
-		{"if (1 < 2) { 10 } else { 20 }", 10},
-	}
-
-	for _, tt := range tests {
-		evaluated := testEval(tt.input)
-		integer, ok := tt.expected.(int)
-		if ok {
-			testIntegerObject(t, evaluated, int64(integer))
-		} else {
-			testNullObject(t, evaluated)
-		}
-	}
-}
-
-func TestBangOperator(t *testing.T) {
-	tests := []struct {
-		input    string
-		expected bool
-	}{
-		{"!true", false},
-		{"!false", true},
-		{"!!true", true},
-		{"!!false", false},
-		{"!5", true}, // everything expect “true” is falsy
-		{"!!5", false},
-	}
+func TestSafeEvalRecoversPanics(t *testing.T) {
+	lxr := lexer.New("var a = 1;\nboom();\na + 1")
+	parsr := parser.New(lxr)
+	program := parsr.ParseProgram()
 
-	for _, tt := range tests {
-		evaluated := testEval(tt.input)
-		testBooleanObject(t, evaluated, tt.expected)
-	}
-}
+	env := object.NewEnvironment()
+	env.Set("boom", &object.Builtin{Fun: func(args ...object.Object) object.Object {
+		var arr []object.Object
+		return arr[len(args)+1]
+	}})
 
-func TestReturnStatements(t *testing.T) {
-	tests := []struct {
-		input    string
-		expected int64
-	}{
-		{"return 420;", 420},
-		{"return 420; 9;", 420},
-		{"return 2 * 5; 9;", 10},
-		{"9; return 2 * 5; 9;", 10},
-		{` if (10 > 1) { if (10 > 1) { return 10; }  return 1; } `, 10},
+	evaluated := SafeEval(program, env)
+	errorObject, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("object is not Error, got=%T(%v)", evaluated, evaluated)
 	}
 
-	for _, tt := range tests {
-		evaluated := testEval(tt.input)
-		if !testIntegerObject(t, evaluated, tt.expected) {
-			t.Logf("<< %q", tt.input)
-		}
+	expected := "internal error: runtime error: index out of range [1] with length 0"
+	if errorObject.Message != expected {
+		t.Errorf("wrong error message, got=%q, want=%q", errorObject.Message, expected)
 	}
-}
-
-func TestErrorHandling(t *testing.T) {
-	tests := []struct {
-		input           string
-		expectedMessage string
-	}{
-		{"5 + true;", "type mismatch: Integer + Boolean"},
-		{"5 + true; 5;", "type mismatch: Integer + Boolean"},
-		{"-true", "invalid usage of `-` operator: -Boolean"},
-		{"true + false;", "unknown operator: Boolean + Boolean"},
-		{"5; true + false; 5", "unknown operator: Boolean + Boolean"},
-		{"if (10 > 1) { true + false; }", "unknown operator: Boolean + Boolean"},
-		{` if (10 > 1) { if (10 > 1) { return true + false; }  return 1; } `, "unknown operator: Boolean + Boolean"},
-		{"foobar", "identifier not found: foobar"},
-		{"if (false) { var x = 10; } x;", "identifier not found: x"},
-		{`"hello" - "world"`, "unknown operator: String - String"},
+	if errorObject.Kind != object.RUNTIME_ERROR {
+		t.Errorf("wrong error kind, got=%q", errorObject.Kind)
 	}
 
-	for _, tt := range tests {
-		evaluated := testEval(tt.input)
-		errorObject, ok := evaluated.(*object.Error)
-		if !ok {
-			t.Errorf("object is not Error, got=%T(%v)", evaluated, evaluated)
-			continue
-		}
-		if errorObject.Message != tt.expectedMessage {
-			t.Errorf("wrong error message, got=%q, want=%q", errorObject.Message, tt.expectedMessage)
-		}
+	if errorObject.Pos.Line != 2 {
+		t.Errorf("wrong error position, got=%s", errorObject.Pos)
 	}
-}
 
-func TestVarStatement(t *testing.T) {
-	tests := []struct {
-		input    string
-		expected int64
-	}{
-		{"var a = 5; a;", 5},
-		{"var a = 5 * 5; a;", 25},
-		{"var a = 5; var b = a; b;", 5},
-		{"var a = 5; var b = a; var c = a + b + 5; c;", 15},
+	// the environment survives the panic
+	if value, ok := env.Get("a"); !ok || value.Inspect() != "1" {
+		t.Errorf("environment lost after panic, a=%v", value)
 	}
 
-	for _, tt := range tests {
-		evaluated := testEval(tt.input)
-		testIntegerObject(t, evaluated, tt.expected)
-	}
+	enginetest.IntegerObject(t, SafeEval(program.Statements[2], env), 2)
 }
 
 func TestFunctionObject(t *testing.T) {
@@ -212,186 +82,157 @@ func TestFunctionObject(t *testing.T) {
 	}
 }
 
-func TestFunctionCall(t *testing.T) {
+func TestTailCalls(t *testing.T) {
 	tests := []struct {
 		input    string
-		expected int64
+		expected string
 	}{
-		{"var identity = fun(x) { x; }; identity(5);", 5},
-		{"var identity = fun(x) { return x; }; identity(5);", 5},
-		{"var double = fun(x) { x * 2; }; double(5);", 10},
-		{"var add = fun(x, y) { x + y; }; add(5, 5);", 10},
-		{"var add = fun(x, y) { x + y; }; add(5 + 5, add(5, 5));", 20},
-		{"fun(x) { x; }(5)", 5},
+		{"fun sum(n, acc) { if (n == 0) { return acc } return sum(n - 1, acc + n) }; sum(1000000, 0)", "500000500000"},
+		{"fun even(n) { if (n == 0) { return true } return odd(n - 1) }\nfun odd(n) { if (n == 0) { return false } return even(n - 1) }\neven(1000000)", "true"},
+		{"fun count(n) { while (true) { if (n == 0) { return \"done\" } return count(n - 1) } }; count(1000000)", "done"},
+		{"fun f(xs) { return len(xs) }; f([1, 2])", "2"},
+		{"fun f() { return 5 }; return f()", "5"},
+		{"fun g() { throw \"boom\" }; fun f() { try { return g() } catch (e) { return e[\"message\"] } }; f()", "boom"},
+		{"var log = [0]; fun g() { log = push(log, 1) }; fun f() { try { return g() } finally { log = push(log, 2) } }; f(); log", "[0, 1, 2]"},
+		{"fun f() { return 5() }; f()", "Error at 1:19: not a function: Integer"},
+		{"fun g(a) { a }; fun f() { return g() }; f()", "Error at 1:35: wrong number of arguments to `g`, got=0, want=1"},
+		{"fun g(n) { n }; fun f() { [if (true) { return g(5) }] }; f()", "[5]"},
 	}
 
 	for _, tt := range tests {
 		evaluated := testEval(tt.input)
-		testIntegerObject(t, evaluated, tt.expected)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%q: wrong result, got=%q, want=%q", tt.input, evaluated.Inspect(), tt.expected)
+		}
+	}
+
+	evaluated := testEval("fun fail() { 1 / 0 }\nfun f(n) { if (n == 0) { return fail() } return f(n - 1) }\nf(3)")
+	errorObject, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("object is not Error, got=%T(%v)", evaluated, evaluated)
+	}
+	// each tail call replaces the call that made it, down to the first one
+	expected := "\tin `fail` called at 2:37"
+	if errorObject.StackTrace() != expected {
+		t.Errorf("wrong stack trace, got=%q, want=%q", errorObject.StackTrace(), expected)
 	}
 }
 
-func TestStringLiteral(t *testing.T) {
+func TestEvalContextLimits(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
 	tests := []struct {
-		input    string
-		expected string
+		input           string
+		ctx             context.Context
+		limits          Limits
+		expectedMessage string
 	}{
-		{`"nice"`, "nice"},
-		{`"hello" + " world"`, "hello world"},
+		{"while (true) { 1 }", context.Background(), Limits{MaxSteps: 1000}, "step limit of 1000 exceeded"},
+		{"fun f() { f() + 1 }; f()", context.Background(), Limits{MaxCallDepth: 100}, "call depth limit of 100 exceeded"},
+		{"fun f() { f() + 1 }; f()", context.Background(), Limits{}, "call depth limit of 10000 exceeded"},
+		{"while (true) { 1 }", context.Background(), Limits{Timeout: 10 * time.Millisecond}, "evaluation timed out"},
+		{"1 + 1", cancelled, Limits{}, "evaluation cancelled"},
+		{"var a = [0]; while (true) { a = push(a, 1) }", context.Background(), Limits{MaxAllocations: 1000}, "allocation limit of 1000 objects exceeded"},
+		{"var s = \"ab\"; while (true) { s += s }", context.Background(), Limits{MaxStringBytes: 1 << 20}, "string limit of 1048576 bytes exceeded"},
+		{"fun f() { try { while (true) { 1 } } catch (e) { 1 } finally { return 2 } }; f()", context.Background(), Limits{MaxSteps: 1000}, "step limit of 1000 exceeded"},
+		{"fun f(n) { if (n == 0) { return 0 } return f(n - 1) }; f(1000)", context.Background(), Limits{MaxCallDepth: 10, MaxSteps: 100}, "step limit of 100 exceeded"},
 	}
 
 	for _, tt := range tests {
-		evaluated := testEval(tt.input)
-		str, ok := evaluated.(*object.String)
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		env := object.NewEnvironment()
+
+		evaluated := EvalContext(tt.ctx, program, env, tt.limits)
+		errorObject, ok := evaluated.(*object.Error)
 		if !ok {
-			t.Fatalf("object is not String. got=%T (%+v)", evaluated, evaluated)
+			t.Errorf("%q: object is not Error, got=%T(%v)", tt.input, evaluated, evaluated)
+			continue
 		}
-
-		if str.Value != tt.expected {
-			t.Errorf("value is wrong. got=%q, want=%q", str.Value, tt.expected)
+		if errorObject.Kind != object.LIMIT_ERROR {
+			t.Errorf("%q: wrong error kind, got=%q", tt.input, errorObject.Kind)
+		}
+		if errorObject.Message != tt.expectedMessage {
+			t.Errorf("%q: wrong error message, got=%q, want=%q", tt.input, errorObject.Message, tt.expectedMessage)
+		}
+		if env.Meter != nil {
+			t.Errorf("%q: meter left on the environment", tt.input)
 		}
 	}
+
+	// functions created under limits aren't bound by them afterwards
+	env := object.NewEnvironment()
+	program := parser.New(lexer.New("fun f(n) { if (n == 0) { return 0 } 1 + f(n - 1) }; f(10)")).ParseProgram()
+	enginetest.IntegerObject(t, EvalContext(context.Background(), program, env, Limits{MaxSteps: 10000}), 10)
+	enginetest.IntegerObject(t, Eval(parser.New(lexer.New("f(1000)")).ParseProgram(), env), 1000)
 }
 
-func TestBuiltinFunction(t *testing.T) {
+func TestResolvedEval(t *testing.T) {
 	tests := []struct {
 		input    string
-		expected interface{}
+		expected string
 	}{
-		{`len("")`, 0},
-		{`len("hello")`, 5},
-		{"len(`hello`)", 5},
-		{"len([1,2,3])", 3},
-		{`len(69)`, object.Error{Message: "argument to `len` not supported, got Integer"}},
-		{`len("one", "one")`, object.Error{Message: "wrong number of arguments, got=2, want=1"}},
-		//{`puts("hello", "world!")`, nil},
-		{`head([1, 2, 3])`, 1},
-		{`head([])`, nil},
-		{`head("hello")`, "h"},
-		{`head("")`, nil},
-		{`head(1)`, object.Error{Message: "argument to `head` not supported, got Integer"}},
-		{`tail([1, 2, 3])`, []int{2, 3}},
-		{`tail([])`, nil},
-		{`tail("hello")`, "ello"},
-		{`tail("")`, nil},
-		{`last([1, 2, 3])`, 3},
-		{`tail(1)`, object.Error{Message: "argument to `tail` not supported, got Integer"}},
-		{`last([])`, nil},
-		{`last("hello")`, "o"},
-		{`last("")`, nil},
-		{`last(1)`, object.Error{Message: "argument to `last` not supported, got Integer"}},
-		{`push([], 1)`, []int{1}},
-		{`push(1, 1)`, object.Error{Message: "argument to `push` must be Array, got Integer"}},
+		{"fun add(a, b = 2) { a + b }; add(1)", "3"},
+		{"var counter = fun() { var n = 0; fun() { n += 1; n } }(); counter(); counter()", "2"},
+		{"fun f() { fun g() { x }; var x = 5; g() }; f()", "5"},
+		{"fun sum(...xs) { var s = 0; for (x in xs) { s += x } s }; sum(1, 2, 3)", "6"},
+		{"fun f() { try { throw 7 } catch (e) { fun() { e[\"message\"] }() } }; f()", "7"},
+		{"fun f(n) { if (n == 0) { return 0 } var m = n - 1; f(m) }; f(3)", "0"},
+		{"fun f() { x }; var x = 1; f()", "1"},
+		{"fun f() { var a = b; var b = 1; a }; f()", "Error at 1:19: identifier not found: b"},
+		{"len", "builtin function"},
 	}
 
 	for _, tt := range tests {
-		evaluated := testEval(tt.input)
-
-		switch expected := tt.expected.(type) {
-		case int:
-			testIntegerObject(t, evaluated, int64(expected))
-		case object.Error:
-			errObj, ok := evaluated.(*object.Error)
-			if !ok {
-				t.Errorf("object is not Error. got=%T(%v)", evaluated, evaluated)
-				continue
-			}
-
-			if errObj.Message != expected.Message {
-				t.Errorf("wrong error message, got=%q, want=%q", errObj.Message, expected)
-			}
-		case string:
-			str, ok := evaluated.(*object.String)
-			if !ok {
-				t.Errorf("object is not String. got=%T(%v)", evaluated, evaluated)
-				continue
-			}
-			if str.Value != expected {
-				t.Errorf("wrong string, got=%q, want=%q", str.Value, expected)
-			}
+		parsr := parser.New(lexer.New(tt.input))
+		program := parsr.ParseProgram()
+		if len(parsr.Errors()) != 0 {
+			t.Errorf("%q: parser errors: %v", tt.input, parsr.Errors())
+			continue
 		}
-	}
-}
 
-func TestArrayLiterals(t *testing.T) {
-	input := "[420, 69, 2 * 2]"
+		env := object.NewEnvironment()
+		if errors := resolver.Resolve(program, isDefined(env)); len(errors) != 0 {
+			t.Errorf("%q: resolver errors: %v", tt.input, errors)
+			continue
+		}
 
-	evaluated := testEval(input)
-	arr, ok := evaluated.(*object.Array)
-	if !ok {
-		t.Fatalf("object is not Array. got=%T (%+v)", evaluated, evaluated)
+		evaluated := Eval(program, env)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%q: wrong result, got=%q, want=%q", tt.input, evaluated.Inspect(), tt.expected)
+		}
 	}
+}
 
-	if len(arr.Elements) != 3 {
-		t.Fatalf("array has wrong number of elements. got=%d, want=%d", len(arr.Elements), 3)
+func isDefined(env *object.Environment) func(name string) bool {
+	return func(name string) bool {
+		_, ok := env.Get(name)
+		_, builtin := LookupBuiltin(name)
+		return ok || builtin
 	}
+}
 
-	testIntegerObject(t, arr.Elements[0], 420)
-	testIntegerObject(t, arr.Elements[1], 69)
-	testIntegerObject(t, arr.Elements[2], 4)
+func BenchmarkFib(b *testing.B) {
+	input := `
+var fib = fun (n) {
+if (n <=1) {
+return n;
+}
+return fib(n-1) + fib(n-2);
 }
 
-func TestArrayIndexExpressions(t *testing.T) {
-	tests := []struct {
-		input    string
-		expected interface{}
-	}{
-		{
-			"[1, 2, 3][0]",
-			1,
-		},
-		{
-			"[1, 2, 3][1]",
-			2,
-		},
-		{
-			"[1, 2, 3][2]",
-			3,
-		},
-		{
-			"var i = 0; [1][i];",
-			1,
-		},
-		{
-			"[1, 2, 3][1 + 1];",
-			3,
-		},
-		{
-			"var myArray = [1, 2, 3]; myArray[2];",
-			3,
-		},
-		{
-			"var myArray = [1, 2, 3]; myArray[0] + myArray[1] + myArray[2];",
-			6,
-		},
-		{
-			"var myArray = [1, 2, 3]; var i = myArray[0]; myArray[i]",
-			2,
-		},
-		{
-			"[1, 2, 3][3]",
-			nil,
-		},
-		{
-			"[1, 2, 3][-1]",
-			nil,
-		},
-	}
+fib(20)
+`
+	program := parser.New(lexer.New(input)).ParseProgram()
 
-	for _, tt := range tests {
-		evaluated := testEval(tt.input)
-		integer, ok := tt.expected.(int)
-		if ok {
-			testIntegerObject(t, evaluated, int64(integer))
-		} else {
-			testNullObject(t, evaluated)
-		}
+	for i := 0; i < b.N; i++ {
+		Eval(program, object.NewEnvironment())
 	}
 }
 
-func BenchmarkFib(b *testing.B) {
+func BenchmarkFibResolved(b *testing.B) {
 	input := `
-var fib = fun (n) {
+fun fib(n) {
 if (n <=1) {
 return n;
 }
@@ -400,8 +241,11 @@ return fib(n-1) + fib(n-2);
 
 fib(20)
 `
+	program := parser.New(lexer.New(input)).ParseProgram()
+	resolver.Resolve(program, nil)
+
 	for i := 0; i < b.N; i++ {
-		testEval(input)
+		Eval(program, object.NewEnvironment())
 	}
 }
 
@@ -412,37 +256,3 @@ func testEval(input string) object.Object {
 	env := object.NewEnvironment()
 	return Eval(program, env)
 }
-
-func testIntegerObject(t *testing.T, obj object.Object, expected int64) bool {
-	result, ok := obj.(*object.Integer)
-	if !ok {
-		t.Errorf("object is not Integer. got=%T (%+v)", obj, obj)
-		return false
-	}
-
-	if result.Value != expected {
-		t.Errorf("object has wrong value. got=%d, want=%d", result.Value, expected)
-		return false
-	}
-	return true
-}
-
-func testBooleanObject(t *testing.T, obj object.Object, expected bool) bool {
-	result, ok := obj.(*object.Boolean)
-	if !ok {
-		t.Errorf("object is not Boolean. got=%T (%+v)", obj, obj)
-		return false
-	}
-	if result.Value != expected {
-		t.Errorf("boolean value is wrong. got=%t, want=%t", result.Value, expected)
-		return false
-	}
-	return true
-}
-func testNullObject(t *testing.T, obj object.Object) bool {
-	if obj != NULL {
-		t.Errorf("Null object has wrong value. got=%T (%+v)", obj, obj)
-		return false
-	}
-	return true
-}
@@ -0,0 +1,177 @@
+package eval
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-interpreter/ast"
+	"go-interpreter/object"
+	"go-interpreter/token"
+	"time"
+)
+
+// Limits bound the work of an evaluation, zero means no limit.
+type Limits struct {
+	// MaxSteps is the number of AST nodes that may be evaluated
+	MaxSteps int64
+	// MaxCallDepth is how deep function calls may nest, tail calls don't nest.
+	// Zero means DefaultMaxCallDepth
+	MaxCallDepth int
+	Timeout      time.Duration
+	// MaxAllocations is the number of objects that may be created, arrays and
+	// hashes counting their elements too
+	MaxAllocations int64
+	// MaxStringBytes is the total size of the strings that may be created
+	MaxStringBytes int64
+}
+
+// contextCheckInterval is how many steps go by between checks of the context.
+const contextCheckInterval = 1024
+
+// DefaultMaxCallDepth keeps runaway recursion well below the depth where the Go
+// stack overflows, which would crash the host program instead of failing the script.
+const DefaultMaxCallDepth = 10000
+
+// EvalContext evaluates node like SafeEval, stopping with a LIMIT_ERROR once ctx
+// is done or one of limits is hit.
+func EvalContext(ctx context.Context, node ast.Node, env *object.Environment, limits Limits) object.Object {
+	return withMeter(ctx, env, limits, func() object.Object {
+		return SafeEval(node, env)
+	})
+}
+
+// ApplyContext calls function, a Function or Builtin known as name, with args
+// from Go code. The call runs in env under limits, like EvalContext.
+func ApplyContext(ctx context.Context, name string, function object.Object, args []object.Object, env *object.Environment, limits Limits) object.Object {
+	return withMeter(ctx, env, limits, func() (result object.Object) {
+		defer func() {
+			if r := recover(); r != nil {
+				result = &object.Error{Kind: object.RUNTIME_ERROR, Message: fmt.Sprintf("internal error: %v", r)}
+			}
+		}()
+		return applyFunction(env, name, token.Position{}, function, args)
+	})
+}
+
+// withMeter runs eval with a meter enforcing limits on env.
+func withMeter(ctx context.Context, env *object.Environment, limits Limits, eval func() object.Object) object.Object {
+	if limits.MaxCallDepth == 0 {
+		limits.MaxCallDepth = DefaultMaxCallDepth
+	}
+
+	if limits.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, limits.Timeout)
+		defer cancel()
+	}
+
+	previous := env.Meter
+	env.Meter = &meter{ctx: ctx, limits: limits}
+	defer func() { env.Meter = previous }()
+
+	return eval()
+}
+
+// meter enforces Limits, see object.Meter.
+type meter struct {
+	ctx    context.Context
+	limits Limits
+
+	steps       int64
+	depth       int
+	allocations int64
+	stringBytes int64
+}
+
+func (m *meter) Step() *object.Error {
+	m.steps++
+	if m.limits.MaxSteps > 0 && m.steps > m.limits.MaxSteps {
+		return limitError("step limit of %d exceeded", m.limits.MaxSteps)
+	}
+
+	if m.steps%contextCheckInterval == 1 {
+		switch err := m.ctx.Err(); {
+		case errors.Is(err, context.DeadlineExceeded):
+			return limitError("evaluation timed out")
+		case err != nil:
+			return limitError("evaluation cancelled")
+		}
+	}
+	return nil
+}
+
+func (m *meter) Enter() *object.Error {
+	if m.limits.MaxCallDepth > 0 && m.depth >= m.limits.MaxCallDepth {
+		return limitError("call depth limit of %d exceeded", m.limits.MaxCallDepth)
+	}
+	m.depth++
+	return nil
+}
+
+func (m *meter) Leave() {
+	m.depth--
+}
+
+func (m *meter) Allocate(obj object.Object) *object.Error {
+	switch obj := obj.(type) {
+	case *object.Boolean, *object.Null:
+		// shared singletons, nothing new
+		return nil
+	case *object.String:
+		m.allocations++
+		m.stringBytes += int64(len(obj.Value))
+	case *object.Array:
+		m.allocations += 1 + int64(len(obj.Elements))
+	case *object.Hash:
+		m.allocations += 1 + int64(len(obj.Pairs))
+	default:
+		m.allocations++
+	}
+
+	if m.limits.MaxAllocations > 0 && m.allocations > m.limits.MaxAllocations {
+		return limitError("allocation limit of %d objects exceeded", m.limits.MaxAllocations)
+	}
+	if m.limits.MaxStringBytes > 0 && m.stringBytes > m.limits.MaxStringBytes {
+		return limitError("string limit of %d bytes exceeded", m.limits.MaxStringBytes)
+	}
+	return nil
+}
+
+// evalMetered evaluates node, accounting for it with the meter of env.
+func evalMetered(node ast.Node, env *object.Environment) object.Object {
+	if err := env.Meter.Step(); err != nil {
+		return err
+	}
+
+	result := evalNode(node, env)
+	if allocates(node) && !isError(result) {
+		if err := env.Meter.Allocate(result); err != nil {
+			return err
+		}
+	}
+	return result
+}
+
+// allocates tells whether evaluating node creates its result, rather than
+// passing on an object that already exists. Calls account for their results
+// where the function creates them.
+func allocates(node ast.Node) bool {
+	switch node := node.(type) {
+	case *ast.IntegerLiteral, *ast.FloatLiteral, *ast.StringLiteral, *ast.ArrayLiteral, *ast.HashLiteral,
+		*ast.FunctionLiteral, *ast.PrefixExpression, *ast.InfixExpression:
+		return true
+	case *ast.AssignExpression:
+		return node.Operator != "="
+	default:
+		return false
+	}
+}
+
+func limitError(format string, a ...interface{}) *object.Error {
+	return &object.Error{Kind: object.LIMIT_ERROR, Message: fmt.Sprintf(format, a...)}
+}
+
+func isLimitError(obj object.Object) bool {
+	err, ok := obj.(*object.Error)
+	return ok && err.Kind == object.LIMIT_ERROR
+}
@@ -0,0 +1,50 @@
+package eval
+
+import "go-interpreter/object"
+
+// The functions below expose the evaluator's rules on already evaluated values,
+// so other engines, like the bytecode vm, give the same results and errors.
+
+func InfixOperation(operator string, left object.Object, right object.Object) object.Object {
+	return evalInfixExpression(operator, left, right)
+}
+
+func PrefixOperation(operator string, right object.Object) object.Object {
+	return evalPrefixExpression(operator, right)
+}
+
+func IndexOperation(left object.Object, index object.Object) object.Object {
+	return evalIndexExpression(left, index)
+}
+
+// LookupBuiltin finds the builtin function called name.
+func LookupBuiltin(name string) (*object.Builtin, bool) {
+	builtin, ok := builtins[name]
+	return builtin, ok
+}
+
+// ArityError is the error for calling the function name, taking min to max
+// arguments (max is -1 for variadic functions), with got of them. It is nil
+// when got is acceptable.
+func ArityError(name string, min int, max int, got int) *object.Error {
+	return arityError(name, min, max, got)
+}
+
+// IterationItems lists the values `for (x in iterable)` visits.
+func IterationItems(iterable object.Object) ([]object.Object, *object.Error) {
+	return iterationItems(iterable)
+}
+
+// ThrownError is the error raised by `throw value`.
+func ThrownError(value object.Object) *object.Error {
+	return thrownError(value)
+}
+
+// CaughtError is the value `catch (e)` binds for err.
+func CaughtError(err *object.Error) *object.Hash {
+	return caughtError(err)
+}
+
+func NewError(format string, a ...interface{}) *object.Error {
+	return newError(format, a...)
+}
@@ -0,0 +1,1205 @@
+// Package enginetest holds the tests every engine running programs has to
+// pass, so the tree-walking evaluator and the virtual machine agree.
+package enginetest
+
+import (
+	"fmt"
+	"go-interpreter/object"
+	"strings"
+	"testing"
+)
+
+// Engine runs a whole program the way itop would, resolving it first, and
+// returns its value.
+type Engine func(input string) object.Object
+
+var tests = []struct {
+	name string
+	run  func(t *testing.T, testEval Engine)
+}{
+	{"EvalIntegerExpression", testEvalIntegerExpression},
+	{"EvalModuloPowerAndBitwise", testEvalModuloPowerAndBitwise},
+	{"EvalFloatExpression", testEvalFloatExpression},
+	{"FloatInspect", testFloatInspect},
+	{"EvalBooleanExpression", testEvalBooleanExpression},
+	{"EvalConditionsExpression", testEvalConditionsExpression},
+	{"LogicalOperators", testLogicalOperators},
+	{"BangOperator", testBangOperator},
+	{"ReturnStatements", testReturnStatements},
+	{"ErrorHandling", testErrorHandling},
+	{"ErrorPositions", testErrorPositions},
+	{"ErrorStackTrace", testErrorStackTrace},
+	{"TryCatch", testTryCatch},
+	{"DivisionByZero", testDivisionByZero},
+	{"VarStatement", testVarStatement},
+	{"AssignExpression", testAssignExpression},
+	{"AssignExpressionErrors", testAssignExpressionErrors},
+	{"FunctionCall", testFunctionCall},
+	{"FunctionDeclarations", testFunctionDeclarations},
+	{"FunctionArity", testFunctionArity},
+	{"DefaultAndRestParameters", testDefaultAndRestParameters},
+	{"StringLiteral", testStringLiteral},
+	{"BuiltinFunction", testBuiltinFunction},
+	{"ArrayLiterals", testArrayLiterals},
+	{"ArrayIndexExpressions", testArrayIndexExpressions},
+	{"HashLiterals", testHashLiterals},
+	{"HashIndexExpressions", testHashIndexExpressions},
+	{"Loops", testLoops},
+	{"LoopErrors", testLoopErrors},
+	{"LocalsBeforeVar", testLocalsBeforeVar},
+}
+
+// Run runs the shared tests against engine, each one as a subtest.
+func Run(t *testing.T, engine Engine) {
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.run(t, engine)
+		})
+	}
+}
+
+func testEvalIntegerExpression(t *testing.T, testEval Engine) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"420", 420},
+		{"69", 69},
+		{"420", 420},
+		{"-420", -420},
+		{"-69", -69},
+		{"--420", 420},
+		{"--69", 69},
+		{"5 + 5 + 5 + 5 - 10", 10},
+		{"2 * 2 * 2 * 2 * 2", 32},
+		{"-50 + 100 + -50", 0},
+		{"5 * 2 + 10", 20},
+		{"5 + 2 * 10", 25},
+		{"20 + 2 * -10", 0},
+		{"50 / 2 * 2 + 10", 60},
+		{"2 * (5 + 10)", 30},
+		{"3 * 3 * 3 + 10", 37},
+		{"3 * (3 * 3) + 10", 37},
+		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50}}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		IntegerObject(t, evaluated, tt.expected)
+	}
+}
+
+func testEvalModuloPowerAndBitwise(t *testing.T, testEval Engine) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"7 % 3", 1},
+		{"-7 % 3", -1},
+		{"7 % -3", 1},
+		{"2 + 7 % 4", 5},
+		{"2 ** 10", 1024},
+		{"2 ** 3 ** 2", 512},
+		{"(-2) ** 3", -8},
+		{"-2 ** 2", -4},
+		{"5 ** 0", 1},
+		{"2 ** 63", -9223372036854775808}, // wraps around like *
+		{"2 ** 64", 0},
+		{"6 & 3", 2},
+		{"6 | 3", 7},
+		{"6 ^ 3", 5},
+		{"~0", -1},
+		{"~5", -6},
+		{"1 << 4", 16},
+		{"256 >> 4", 16},
+		{"-16 >> 2", -4},
+		{"1 << 63", -9223372036854775808},
+		{"1 << 64", 0},
+		{"-1 >> 100", -1},
+		{"0xFF & ~0x0F", 0xF0},
+		{"1 | 2 ^ 3 & 4 << 1", 3},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if !IntegerObject(t, evaluated, tt.expected) {
+			t.Logf("<< %q", tt.input)
+		}
+	}
+
+	floatTests := []struct {
+		input    string
+		expected float64
+	}{
+		{"2.0 ** 3", 8},
+		{"2 ** -1.0", 0.5},
+		{"7.5 % 2", 1.5},
+	}
+
+	for _, tt := range floatTests {
+		evaluated := testEval(tt.input)
+		if !FloatObject(t, evaluated, tt.expected) {
+			t.Logf("<< %q", tt.input)
+		}
+	}
+
+	errorTests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"1 << -1", "negative shift count: 1 << -1"},
+		{"8 >> -2", "negative shift count: 8 >> -2"},
+		{"2 ** -1", "negative exponent: 2 ** -1"},
+		{"1.5 & 1", "unknown operator: Float & Integer"},
+		{"true | false", "unknown operator: Boolean | Boolean"},
+		{"~1.5", "invalid usage of `~` operator: ~Float"},
+	}
+
+	for _, tt := range errorTests {
+		evaluated := testEval(tt.input)
+		errorObject, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("object is not Error, got=%T(%v)", evaluated, evaluated)
+			continue
+		}
+		if errorObject.Message != tt.expectedMessage {
+			t.Errorf("wrong error message, got=%q, want=%q", errorObject.Message, tt.expectedMessage)
+		}
+	}
+}
+
+func testEvalFloatExpression(t *testing.T, testEval Engine) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"3.14", 3.14},
+		{"-2.5", -2.5},
+		{"0.25 + 0.5", 0.75},
+		{"1.5 * 2", 3},
+		{"2 * 1.5", 3},
+		{"1 + 0.5", 1.5},
+		{"7 / 2.0", 3.5},
+		{"10 - 2.5 * 2", 5},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if !FloatObject(t, evaluated, tt.expected) {
+			t.Logf("<< %q", tt.input)
+		}
+	}
+}
+
+func testFloatInspect(t *testing.T, testEval Engine) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"3.14", "3.14"},
+		{"3.0", "3.0"},
+		{"1.5 * 2", "3.0"},
+		{"1e21", "1e+21"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong Inspect(). got=%q, want=%q", evaluated.Inspect(), tt.expected)
+		}
+	}
+}
+
+func testEvalBooleanExpression(t *testing.T, testEval Engine) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"true", true},
+		{"false", false},
+		{"1 < 2", true},
+		{"1 > 2", false},
+		{"1 < 1", false},
+		{"1 > 1", false},
+		{"1 == 1", true},
+		{"1 != 1", false},
+		{"1 == 2", false},
+		{"1 != 2", true},
+		{"1 <= 2", true},
+		{"1 >= 2", false},
+		{"true == true", true},
+		{"false == false", true},
+		{"true == false", false},
+		{"true != false", true},
+		{"false != true", true},
+		{"(1 < 2) == true", true},
+		{"(1 < 2) == false", false},
+		{"(1 > 2) == true", false},
+		{"(1 > 2) == false", true},
+		{`"nice" == "nice"`, true},
+		{`"hello" != "nice"`, true},
+		{`"hello" == "nice"`, false},
+		{"1.5 < 2.5", true},
+		{"1 < 1.5", true},
+		{"2.0 >= 2", true},
+		{"1 == 1.0", true},
+		{"0.1 + 0.2 != 0.3", true},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if !BooleanObject(t, evaluated, tt.expected) {
+			t.Logf("<< %q", tt.input)
+		}
+	}
+}
+
+func testEvalConditionsExpression(t *testing.T, testEval Engine) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"if (true) { 10 }", 10},
+		{"if (false) { 10 }", nil},
+		{"if (1) { 10 }", nil}, // anything expect "true" is falsy
+		{"if (1 < 2) { 10 }", 10},
+		{"if (1 > 2) { 10 }", nil},
+		{"if (1 > 2) { 10 } else { 20 }", 20},
+		{"if (1 < 2) { 10 } else { 20 }", 10},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		integer, ok := tt.expected.(int)
+		if ok {
+			IntegerObject(t, evaluated, int64(integer))
+		} else {
+			NullObject(t, evaluated)
+		}
+	}
+}
+
+func testLogicalOperators(t *testing.T, testEval Engine) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"true && true", true},
+		{"true && false", false},
+		{"false && true", false},
+		{"false || true", true},
+		{"false || false", false},
+		{"1 < 2 && 2 < 3", true},
+		{"1 > 2 || 2 > 3", false},
+		{"1 && true", false}, // only `true` is truthy
+		{"true && 1", false},
+		{"1 || true", true},
+		{"false && undefined", false},
+		{"true || undefined", true},
+		{"false && 1 + true", false},
+		{"var calls = 0; var f = fun() { calls += 1; true }; false && f(); true || f(); calls == 0", true},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if !BooleanObject(t, evaluated, tt.expected) {
+			t.Logf("<< %q", tt.input)
+		}
+	}
+
+	evaluated := testEval("true && undefined")
+	errorObject, ok := evaluated.(*object.Error)
+	if !ok || errorObject.Message != "identifier not found: undefined" {
+		t.Errorf("expected identifier error from the right side, got=%T(%v)", evaluated, evaluated)
+	}
+}
+
+func testBangOperator(t *testing.T, testEval Engine) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"!true", false},
+		{"!false", true},
+		{"!!true", true},
+		{"!!false", false},
+		{"!5", true}, // everything expect “true” is falsy
+		{"!!5", false},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		BooleanObject(t, evaluated, tt.expected)
+	}
+}
+
+func testReturnStatements(t *testing.T, testEval Engine) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"return 420;", 420},
+		{"return 420; 9;", 420},
+		{"return 2 * 5; 9;", 10},
+		{"9; return 2 * 5; 9;", 10},
+		{` if (10 > 1) { if (10 > 1) { return 10; }  return 1; } `, 10},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if !IntegerObject(t, evaluated, tt.expected) {
+			t.Logf("<< %q", tt.input)
+		}
+	}
+}
+
+func testErrorHandling(t *testing.T, testEval Engine) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"5 + true;", "type mismatch: Integer + Boolean"},
+		{"5 + true; 5;", "type mismatch: Integer + Boolean"},
+		{"-true", "invalid usage of `-` operator: -Boolean"},
+		{"true + false;", "unknown operator: Boolean + Boolean"},
+		{"5; true + false; 5", "unknown operator: Boolean + Boolean"},
+		{"if (10 > 1) { true + false; }", "unknown operator: Boolean + Boolean"},
+		{` if (10 > 1) { if (10 > 1) { return true + false; }  return 1; } `, "unknown operator: Boolean + Boolean"},
+		{"foobar", "identifier not found: foobar"},
+		{"if (false) { var x = 10; } x;", "identifier not found: x"},
+		{`"hello" - "world"`, "unknown operator: String - String"},
+		{`{"name": "itop"}[fun(x) { x }];`, "unusable as hash key: Function"},
+		{`{[1]: 2}`, "unusable as hash key: Array"},
+		{"1.5 + true", "type mismatch: Float + Boolean"},
+		{`1 + "a"`, "type mismatch: Integer + String"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errorObject, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("object is not Error, got=%T(%v)", evaluated, evaluated)
+			continue
+		}
+		if errorObject.Message != tt.expectedMessage {
+			t.Errorf("wrong error message, got=%q, want=%q", errorObject.Message, tt.expectedMessage)
+		}
+	}
+}
+
+func testErrorPositions(t *testing.T, testEval Engine) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"5 + true;", "1:3"},
+		{"var a = 1;\n\n  foobar;", "3:3"},
+		{"var f = fun(x) {\n  x - \"a\"\n};\nf(1)", "2:5"},
+		{"len(1)", "1:4"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errorObject, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("object is not Error, got=%T(%v)", evaluated, evaluated)
+			continue
+		}
+		if errorObject.Pos.String() != tt.expected {
+			t.Errorf("wrong error position, got=%q, want=%q", errorObject.Pos.String(), tt.expected)
+		}
+	}
+}
+
+func testErrorStackTrace(t *testing.T, testEval Engine) {
+	tests := []struct {
+		input         string
+		expectedStack []string
+	}{
+		{"5 + true;", []string{}},
+		{"fun add(a, b) { a + b }\nadd(1, true)", []string{"`add` 2:4"}},
+		{"fun inner() { len(1) }\nfun outer() {\n  inner()\n}\nouter()", []string{"`inner` 3:8", "`outer` 5:6"}},
+		{"var f = fun() { 1 / 0 };\nfun(g) { g() }(f)", []string{"`f` 2:11", "anonymous function 2:15"}},
+		{"fun f(a, b = 1 + true) { a }\nf(1)", []string{"`f` 2:2"}},
+		{"fun f(a) { a }\nf()", []string{}},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errorObject, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("object is not Error for %q, got=%T(%v)", tt.input, evaluated, evaluated)
+			continue
+		}
+
+		stack := []string{}
+		for _, frame := range errorObject.Stack {
+			stack = append(stack, frame.Description()+" "+frame.CallSite.String())
+		}
+		if strings.Join(stack, ", ") != strings.Join(tt.expectedStack, ", ") {
+			t.Errorf("wrong stack for %q, got=%v, want=%v", tt.input, stack, tt.expectedStack)
+		}
+	}
+
+	evaluated := testEval("fun inner() { len(1) }\nfun outer() {\n  inner()\n}\nouter()")
+	expected := "\tin `inner` called at 3:8\n\tin `outer` called at 5:6"
+	if trace := evaluated.(*object.Error).StackTrace(); trace != expected {
+		t.Errorf("wrong stack trace, got=%q, want=%q", trace, expected)
+	}
+}
+
+func testTryCatch(t *testing.T, testEval Engine) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`try { throw "boom" } catch (e) { e["message"] }`, "boom"},
+		{`try { throw "boom" } catch (e) { e["type"] }`, "Error"},
+		{`try { len(1) } catch (e) { e["message"] }`, "argument to `len` not supported, got Integer"},
+		{`try { len(1) } catch (e) { e["type"] }`, "RuntimeError"},
+		{`try { 1 + true } catch (e) { e["message"] }`, "type mismatch: Integer + Boolean"},
+		{`try { throw {"message": "bad input", "type": "ValueError"} } catch (e) { e["type"] + ": " + e["message"] }`, "ValueError: bad input"},
+		{`try { throw 42 } catch (e) { e["message"] }`, "42"},
+		{`try { 1 } catch (e) { 2 }`, 1},
+		{`try { throw "x" } catch (e) { 2 }`, 2},
+		{`var x = 0; try { x = 1 } finally { x = x + 10 }; x`, 11},
+		{`var x = 0; try { throw "x" } catch (e) { x = 1 } finally { x = x + 10 }; x`, 11},
+		{`var f = fun() { try { return 1 } finally { 2 } }; f()`, 1},
+		{`var f = fun() { try { return 1 } finally { return 2 } }; f()`, 2},
+		{`var n = 0; for (x in [1, 2, 3]) { try { if (x == 2) { break } n += x } finally { n += 10 } }; n`, 21},
+		{`try { try { throw "inner" } catch (e) { throw e } } catch (e) { e["message"] }`, "inner"},
+		{`try { try { throw "inner" } finally { 1 } } catch (e) { e["message"] }`, "inner"},
+		{`fun fail() { throw "nested" } fun call() { fail() } try { call() } catch (e) { len(e["stack"]) }`, 2},
+		{`fun fail() { throw "nested" }
+try { fail() } catch (e) { e["stack"][0] }`, "`fail` called at 2:11"},
+		{`var e = 1; try { throw "x" } catch (e) { e = 2 }; e`, 1},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			IntegerObject(t, evaluated, int64(expected))
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok {
+				t.Errorf("object is not String for %q. got=%T(%v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if str.Value != expected {
+				t.Errorf("wrong value for %q, got=%q, want=%q", tt.input, str.Value, expected)
+			}
+		}
+	}
+
+	errorTests := []struct {
+		input           string
+		expectedKind    string
+		expectedMessage string
+	}{
+		{`throw "boom"`, object.THROWN_ERROR, "boom"},
+		{`throw {"message": "bad", "type": "ValueError"}`, "ValueError", "bad"},
+		{`try { throw "a" } catch (e) { throw "b" }`, object.THROWN_ERROR, "b"},
+		{`try { 1 } finally { throw "c" }`, object.THROWN_ERROR, "c"},
+		{`try { 1 } finally { len(1) }`, object.RUNTIME_ERROR, "argument to `len` not supported, got Integer"},
+		{`throw missing`, object.RUNTIME_ERROR, "identifier not found: missing"},
+	}
+
+	for _, tt := range errorTests {
+		evaluated := testEval(tt.input)
+		errorObject, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("object is not Error for %q, got=%T(%v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errorObject.Kind != tt.expectedKind || errorObject.Message != tt.expectedMessage {
+			t.Errorf("wrong error, got=%s %q, want=%s %q", errorObject.Kind, errorObject.Message, tt.expectedKind, tt.expectedMessage)
+		}
+	}
+
+	rethrown := testEval("fun f() { 1 / 0 } try { f() } catch (e) { throw e }")
+	errorObject, ok := rethrown.(*object.Error)
+	if !ok || errorObject.Pos.String() != "1:13" || errorObject.StackTrace() != "\tin `f` called at 1:26" {
+		t.Errorf("rethrown error lost where it happened, got=%v", rethrown)
+	}
+}
+
+func testDivisionByZero(t *testing.T, testEval Engine) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"1 / 0", "division by zero: 1 / 0"},
+		{"var a = 0; 10 / a", "division by zero: 10 / 0"},
+		{"5 % 0", "division by zero: 5 % 0"},
+		{"var a = 5; a /= 0;", "division by zero: 5 / 0"},
+		{"var a = 5; a %= 0;", "division by zero: 5 % 0"},
+		{"var min = -9223372036854775807 - 1; min / -1", "integer overflow: -9223372036854775808 / -1"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errorObject, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("object is not Error, got=%T(%v)", evaluated, evaluated)
+			continue
+		}
+		if errorObject.Message != tt.expectedMessage {
+			t.Errorf("wrong error message, got=%q, want=%q", errorObject.Message, tt.expectedMessage)
+		}
+	}
+
+	IntegerObject(t, testEval("var min = -9223372036854775807 - 1; min % -1"), 0)
+}
+
+func testVarStatement(t *testing.T, testEval Engine) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"var a = 5; a;", 5},
+		{"var a = 5 * 5; a;", 25},
+		{"var a = 5; var b = a; b;", 5},
+		{"var a = 5; var b = a; var c = a + b + 5; c;", 15},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		IntegerObject(t, evaluated, tt.expected)
+	}
+}
+
+func testAssignExpression(t *testing.T, testEval Engine) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"var a = 5; a = 10; a;", 10},
+		{"var a = 5; a = a + 1;", 6},
+		{"var a = 1; var b = 2; a = b = 3; a + b;", 6},
+		{"var a = 5; a += 2; a;", 7},
+		{"var a = 5; a -= 2; a;", 3},
+		{"var a = 5; a *= 2; a;", 10},
+		{"var a = 5; a /= 2; a;", 2},
+		{"var a = 5; a %= 3; a;", 2},
+		{`var s = "a"; s += "b"; s;`, "ab"},
+		{"var a = 1.5; a *= 2; a;", 3.0},
+		{"var count = 0; var inc = fun() { count += 1; }; inc(); inc(); count;", 2},
+		{"var x = 1; var f = fun() { var x = 2; x = 3; x }; f() + x;", 4},
+		{"var i = 0; var sum = 0; while (i < 5) { sum += i; i += 1; } sum;", 10},
+		{"var sum = 0; for (var i = 0; i < 5; i += 1) { sum += i; } sum;", 10},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			IntegerObject(t, evaluated, int64(expected))
+		case float64:
+			FloatObject(t, evaluated, expected)
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok {
+				t.Errorf("object is not String. got=%T(%v)", evaluated, evaluated)
+				continue
+			}
+			if str.Value != expected {
+				t.Errorf("wrong string, got=%q, want=%q", str.Value, expected)
+			}
+		}
+	}
+}
+
+func testAssignExpressionErrors(t *testing.T, testEval Engine) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"x = 1;", "assignment to undeclared variable: x"},
+		{"var f = fun() { y += 1 }; f();", "assignment to undeclared variable: y"},
+		{"var a = 1; a += true;", "type mismatch: Integer + Boolean"},
+		{"len = 1;", "assignment to undeclared variable: len"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errorObject, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("object is not Error, got=%T(%v)", evaluated, evaluated)
+			continue
+		}
+		if errorObject.Message != tt.expectedMessage {
+			t.Errorf("wrong error message, got=%q, want=%q", errorObject.Message, tt.expectedMessage)
+		}
+	}
+}
+
+// testLocalsBeforeVar checks that a local is the variable of its name in the whole
+// function, a global of the same name is hidden even before the var runs.
+func testLocalsBeforeVar(t *testing.T, testEval Engine) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"var x = 1; fun f() { x = 2; var x = 3; x } [f(), x]", "assignment to undeclared variable: x"},
+		{"var x = 1; fun f() { x += 2; var x = 3; x } f()", "assignment to undeclared variable: x"},
+		{"var x = 1; fun f() { var y = x; var x = 3; y } f()", "identifier not found: x"},
+		{"fun f() { fun g() { x = 5 } g(); var x = 3; x } f()", "assignment to undeclared variable: x"},
+		{"var x = 1; fun f() { var x = 3; x = 4; x } [f(), x]", "[4, 1]"},
+		{"fun f() { fun g() { x = 5 } var x = 3; g(); x } f()", "5"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		result := evaluated.Inspect()
+		if errorObject, ok := evaluated.(*object.Error); ok {
+			result = errorObject.Message
+		}
+		if result != tt.expected {
+			t.Errorf("%q: wrong result, got=%q, want=%q", tt.input, result, tt.expected)
+		}
+	}
+}
+
+func testFunctionCall(t *testing.T, testEval Engine) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"var identity = fun(x) { x; }; identity(5);", 5},
+		{"var identity = fun(x) { return x; }; identity(5);", 5},
+		{"var double = fun(x) { x * 2; }; double(5);", 10},
+		{"var add = fun(x, y) { x + y; }; add(5, 5);", 10},
+		{"var add = fun(x, y) { x + y; }; add(5 + 5, add(5, 5));", 20},
+		{"fun(x) { x; }(5)", 5},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		IntegerObject(t, evaluated, tt.expected)
+	}
+}
+
+func testFunctionDeclarations(t *testing.T, testEval Engine) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"fun add(a, b) { a + b }; add(2, 3)", 5},
+		{"add(2, 3); fun add(a, b) { a + b }", nil},
+		{"var x = add(2, 3); fun add(a, b) { a + b }; x", 5},
+		{"fun isEven(n) { if (n == 0) { return true } isOdd(n - 1) } fun isOdd(n) { if (n == 0) { return false } isEven(n - 1) } isEven(10)", true},
+		{"isOdd(7); fun isOdd(n) { if (n == 0) { return false } isEven(n - 1) } fun isEven(n) { if (n == 0) { return true } isOdd(n - 1) } isOdd(7)", true},
+		{"fun outer() { return inner(); fun inner() { 42 } } outer()", 42},
+		{"fun fact(n) { if (n < 2) { return 1 } n * fact(n - 1) } fact(5)", 120},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			IntegerObject(t, evaluated, int64(expected))
+		case bool:
+			BooleanObject(t, evaluated, expected)
+		case nil:
+			if evaluated != nil {
+				t.Errorf("declaration should evaluate to nothing, got=%T(%v)", evaluated, evaluated)
+			}
+		}
+	}
+
+	errorTests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"fun add(a, b) { a + b }; add(1)", "wrong number of arguments to `add`, got=1, want=2"},
+		{"fun add(a, b) { a + b }; var plus = add; plus(1)", "wrong number of arguments to `add`, got=1, want=2"},
+		{"fun f() { g() } f(); fun g() { 1 + true }", "type mismatch: Integer + Boolean"},
+		{"fun f() {} inner()", "identifier not found: inner"},
+		{"fun outer() { fun inner() {} } outer(); inner()", "identifier not found: inner"},
+		{"var g = fun() { var y = 1 }; var x = g(); x + 1", "type mismatch: Null + Integer"},
+		{"fun outer() { fun inner() {} } outer() + 1", "type mismatch: Null + Integer"},
+	}
+
+	for _, tt := range errorTests {
+		evaluated := testEval(tt.input)
+		errorObject, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("object is not Error for %q, got=%T(%v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errorObject.Message != tt.expectedMessage {
+			t.Errorf("wrong error message, got=%q, want=%q", errorObject.Message, tt.expectedMessage)
+		}
+	}
+
+	inspected := testEval("fun add(a, b = 1) { a + b }; add").Inspect()
+	expected := "fun add(a, b = 1) {\n(a + b)\n}"
+	if inspected != expected {
+		t.Errorf("wrong Inspect, got=%q, want=%q", inspected, expected)
+	}
+}
+
+func testFunctionArity(t *testing.T, testEval Engine) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"fun(a, b) { a }(1)", "wrong number of arguments to anonymous function, got=1, want=2"},
+		{"var add = fun(a, b) { a + b }; add(1, 2, 3)", "wrong number of arguments to `add`, got=3, want=2"},
+		{"var f = fun() { 1 }; f(1)", "wrong number of arguments to `f`, got=1, want=0"},
+		{"var f = fun(x) { x }; var g = fun() { f() }; g()", "wrong number of arguments to `f`, got=0, want=1"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errorObject, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("object is not Error, got=%T(%v)", evaluated, evaluated)
+			continue
+		}
+		if errorObject.Message != tt.expectedMessage {
+			t.Errorf("wrong error message, got=%q, want=%q", errorObject.Message, tt.expectedMessage)
+		}
+	}
+}
+
+func testDefaultAndRestParameters(t *testing.T, testEval Engine) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"var f = fun(a, b = 10) { a + b }; f(1)", 11},
+		{"var f = fun(a, b = 10) { a + b }; f(1, 2)", 3},
+		{"var f = fun(a, b = a * 2) { b }; f(4)", 8},
+		{"var x = 1; var f = fun(a = x) { a }; x = 5; f()", 5},
+		{"var f = fun(...rest) { rest }; f()", []interface{}{}},
+		{"var f = fun(a, ...rest) { rest }; f(1, 2, 3)", []interface{}{2, 3}},
+		{"var f = fun(a, b = 2, ...rest) { [a, b, len(rest)] }; f(1)", []interface{}{1, 2, 0}},
+		{"var add = fun(a, b) { a + b }; add(...[1, 2])", 3},
+		{"var add = fun(a, b, c) { a + b + c }; var xs = [2, 3]; add(1, ...xs)", 6},
+		{"var f = fun(...rest) { len(rest) }; f(...[1, 2], 3, ...[])", 3},
+		{"[0, ...[1, 2], 3]", []interface{}{0, 1, 2, 3}},
+		{"len(...[[1, 2]])", 2},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			IntegerObject(t, evaluated, int64(expected))
+		case []interface{}:
+			arr, ok := evaluated.(*object.Array)
+			if !ok {
+				t.Errorf("object is not Array. got=%T(%v)", evaluated, evaluated)
+				continue
+			}
+			if len(arr.Elements) != len(expected) {
+				t.Errorf("wrong number of elements for %q, got=%d, want=%d", tt.input, len(arr.Elements), len(expected))
+				continue
+			}
+			for i, element := range expected {
+				IntegerObject(t, arr.Elements[i], int64(element.(int)))
+			}
+		}
+	}
+
+	errorTests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"var f = fun(a, b = 1) { a }; f()", "wrong number of arguments to `f`, got=0, want=1 to 2"},
+		{"var f = fun(a, b = 1) { a }; f(1, 2, 3)", "wrong number of arguments to `f`, got=3, want=1 to 2"},
+		{"var f = fun(a, ...rest) { a }; f()", "wrong number of arguments to `f`, got=0, want at least 1"},
+		{"var f = fun(a = 1 + true) { a }; f()", "type mismatch: Integer + Boolean"},
+		{"var f = fun(a) { a }; f(...1)", "cannot spread Integer, expected Array"},
+		{"var a = ...[1];", "spread is only allowed in call arguments and array literals"},
+	}
+
+	for _, tt := range errorTests {
+		evaluated := testEval(tt.input)
+		errorObject, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("object is not Error, got=%T(%v)", evaluated, evaluated)
+			continue
+		}
+		if errorObject.Message != tt.expectedMessage {
+			t.Errorf("wrong error message, got=%q, want=%q", errorObject.Message, tt.expectedMessage)
+		}
+	}
+}
+
+func testStringLiteral(t *testing.T, testEval Engine) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`"nice"`, "nice"},
+		{`"hello" + " world"`, "hello world"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		str, ok := evaluated.(*object.String)
+		if !ok {
+			t.Fatalf("object is not String. got=%T (%+v)", evaluated, evaluated)
+		}
+
+		if str.Value != tt.expected {
+			t.Errorf("value is wrong. got=%q, want=%q", str.Value, tt.expected)
+		}
+	}
+}
+
+func testBuiltinFunction(t *testing.T, testEval Engine) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`len("")`, 0},
+		{`len("hello")`, 5},
+		{"len(`hello`)", 5},
+		{"len([1,2,3])", 3},
+		{`len("größe")`, 5},
+		{`len("hi 👋")`, 4},
+		{`len(69)`, object.Error{Message: "argument to `len` not supported, got Integer"}},
+		{`len("one", "one")`, object.Error{Message: "wrong number of arguments, got=2, want=1"}},
+		//{`puts("hello", "world!")`, nil},
+		{`head([1, 2, 3])`, 1},
+		{`head([])`, nil},
+		{`head("hello")`, "h"},
+		{`head("")`, nil},
+		{`head("élan")`, "é"},
+		{`head(1)`, object.Error{Message: "argument to `head` not supported, got Integer"}},
+		{`tail([1, 2, 3])`, []int{2, 3}},
+		{`tail([])`, nil},
+		{`tail("hello")`, "ello"},
+		{`tail("")`, nil},
+		{`tail("👋hi")`, "hi"},
+		{`last([1, 2, 3])`, 3},
+		{`tail(1)`, object.Error{Message: "argument to `tail` not supported, got Integer"}},
+		{`last([])`, nil},
+		{`last("hello")`, "o"},
+		{`last("")`, nil},
+		{`last("hi 👋")`, "👋"},
+		{`last(1)`, object.Error{Message: "argument to `last` not supported, got Integer"}},
+		{`push([], 1)`, []int{1}},
+		{`push(1, 1)`, object.Error{Message: "argument to `push` must be Array, got Integer"}},
+		{`len({"a": 1, "b": 2})`, 2},
+		{`keys({"a": 1, 2: 3})`, []interface{}{"a", 2}},
+		{`values({"a": 1, 2: 3})`, []interface{}{1, 3}},
+		{`keys(1)`, object.Error{Message: "argument to `keys` must be Hash, got Integer"}},
+		{`values([])`, object.Error{Message: "argument to `values` must be Hash, got Array"}},
+		{`has({"a": 1}, "a")`, true},
+		{`has({"a": 1}, "b")`, false},
+		{`has({"a": 1}, [])`, object.Error{Message: "unusable as hash key: Array"}},
+		{`delete({"a": 1, "b": 2}, "a")["b"]`, 2},
+		{`len(delete({"a": 1, "b": 2}, "a"))`, 1},
+		{`var h = {"a": 1}; delete(h, "a"); h["a"]`, 1},
+		{`delete(1, 1)`, object.Error{Message: "argument to `delete` must be Hash, got Integer"}},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			IntegerObject(t, evaluated, int64(expected))
+		case object.Error:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error. got=%T(%v)", evaluated, evaluated)
+				continue
+			}
+
+			if errObj.Message != expected.Message {
+				t.Errorf("wrong error message, got=%q, want=%q", errObj.Message, expected)
+			}
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok {
+				t.Errorf("object is not String. got=%T(%v)", evaluated, evaluated)
+				continue
+			}
+			if str.Value != expected {
+				t.Errorf("wrong string, got=%q, want=%q", str.Value, expected)
+			}
+		case bool:
+			BooleanObject(t, evaluated, expected)
+		case []interface{}:
+			arr, ok := evaluated.(*object.Array)
+			if !ok {
+				t.Errorf("object is not Array. got=%T(%v)", evaluated, evaluated)
+				continue
+			}
+			if len(arr.Elements) != len(expected) {
+				t.Errorf("wrong number of elements, got=%d, want=%d", len(arr.Elements), len(expected))
+				continue
+			}
+			for i, element := range expected {
+				if arr.Elements[i].Inspect() != fmt.Sprint(element) {
+					t.Errorf("wrong element %d, got=%s, want=%v", i, arr.Elements[i].Inspect(), element)
+				}
+			}
+		}
+	}
+}
+
+func testArrayLiterals(t *testing.T, testEval Engine) {
+	input := "[420, 69, 2 * 2]"
+
+	evaluated := testEval(input)
+	arr, ok := evaluated.(*object.Array)
+	if !ok {
+		t.Fatalf("object is not Array. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if len(arr.Elements) != 3 {
+		t.Fatalf("array has wrong number of elements. got=%d, want=%d", len(arr.Elements), 3)
+	}
+
+	IntegerObject(t, arr.Elements[0], 420)
+	IntegerObject(t, arr.Elements[1], 69)
+	IntegerObject(t, arr.Elements[2], 4)
+}
+
+func testArrayIndexExpressions(t *testing.T, testEval Engine) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{
+			"[1, 2, 3][0]",
+			1,
+		},
+		{
+			"[1, 2, 3][1]",
+			2,
+		},
+		{
+			"[1, 2, 3][2]",
+			3,
+		},
+		{
+			"var i = 0; [1][i];",
+			1,
+		},
+		{
+			"[1, 2, 3][1 + 1];",
+			3,
+		},
+		{
+			"var myArray = [1, 2, 3]; myArray[2];",
+			3,
+		},
+		{
+			"var myArray = [1, 2, 3]; myArray[0] + myArray[1] + myArray[2];",
+			6,
+		},
+		{
+			"var myArray = [1, 2, 3]; var i = myArray[0]; myArray[i]",
+			2,
+		},
+		{
+			"[1, 2, 3][3]",
+			nil,
+		},
+		{
+			"[1, 2, 3][-1]",
+			nil,
+		},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		integer, ok := tt.expected.(int)
+		if ok {
+			IntegerObject(t, evaluated, int64(integer))
+		} else {
+			NullObject(t, evaluated)
+		}
+	}
+}
+
+func testHashLiterals(t *testing.T, testEval Engine) {
+	input := `var two = "two";
+{
+	"one": 10 - 9,
+	two: 1 + 1,
+	"thr" + "ee": 6 / 2,
+	4: 4,
+	true: 5,
+	false: 6
+}`
+
+	evaluated := testEval(input)
+	result, ok := evaluated.(*object.Hash)
+	if !ok {
+		t.Fatalf("Eval didn't return Hash. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	expected := map[object.HashKey]int64{
+		(&object.String{Value: "one"}).HashKey():   1,
+		(&object.String{Value: "two"}).HashKey():   2,
+		(&object.String{Value: "three"}).HashKey(): 3,
+		(&object.Integer{Value: 4}).HashKey():      4,
+		(&object.Boolean{Value: true}).HashKey():   5,
+		(&object.Boolean{Value: false}).HashKey():  6,
+	}
+
+	if len(result.Pairs) != len(expected) {
+		t.Fatalf("Hash has wrong num of pairs. got=%d", len(result.Pairs))
+	}
+
+	for expectedKey, expectedValue := range expected {
+		pair, ok := result.Pairs[expectedKey]
+		if !ok {
+			t.Errorf("no pair for given key in Pairs")
+		}
+
+		IntegerObject(t, pair.Value, expectedValue)
+	}
+
+	if result.Inspect() != "{one: 1, two: 2, three: 3, 4: 4, true: 5, false: 6}" {
+		t.Errorf("wrong Inspect(), got=%q", result.Inspect())
+	}
+}
+
+func testHashIndexExpressions(t *testing.T, testEval Engine) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`{"foo": 5}["foo"]`, 5},
+		{`{"foo": 5}["bar"]`, nil},
+		{`var key = "foo"; {"foo": 5}[key]`, 5},
+		{`{}["foo"]`, nil},
+		{`{5: 5}[5]`, 5},
+		{`{true: 5}[true]`, 5},
+		{`{false: 5}[false]`, 5},
+		{`{"a": 1, "a": 2}["a"]`, 2},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		integer, ok := tt.expected.(int)
+		if ok {
+			IntegerObject(t, evaluated, int64(integer))
+		} else {
+			NullObject(t, evaluated)
+		}
+	}
+}
+
+func testLoops(t *testing.T, testEval Engine) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"var i = 0; while (i < 10) { var i = i + 1; } i", 10},
+		{"var i = 0; while (false) { var i = 1; } i", 0},
+		{"var sum = 0; for (var i = 0; i < 5; 0) { var sum = sum + i; var i = i + 1; } sum", 10},
+		{"var sum = 0; for (x in [1, 2, 3]) { var sum = sum + x; } sum", 6},
+		{`var out = ""; for (c in "héllo") { var out = c + out; } out`, "olléh"},
+		{`var out = 0; for (k in {"a": 1, "b": 2}) { var out = out + len(k); } out`, 2},
+		{"var i = 0; while (true) { var i = i + 1; if (i == 3) { break; } } i", 3},
+		{"var n = 0; for (x in [1, 2, 3, 4]) { if (x == 2) { continue; } var n = n + x; } n", 8},
+		{"var f = fun() { for (x in [1, 2, 3]) { if (x == 2) { return x * 10; } } 0 }; f()", 20},
+		{"for (x in []) { x }", nil},
+		{"var i = 0; var n = 0; while (i < 3) { var i = i + 1; for (x in [1, 2, 3]) { if (x > i) { break; } var n = n + 1; } } n", 6},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			IntegerObject(t, evaluated, int64(expected))
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok {
+				t.Errorf("object is not String. got=%T(%v)", evaluated, evaluated)
+				continue
+			}
+			if str.Value != expected {
+				t.Errorf("wrong string, got=%q, want=%q", str.Value, expected)
+			}
+		default:
+			NullObject(t, evaluated)
+		}
+	}
+}
+
+func testLoopErrors(t *testing.T, testEval Engine) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"for (x in 5) { x }", "cannot iterate over Integer"},
+		{"while (1 + true) { 1 }", "type mismatch: Integer + Boolean"},
+		{"for (x in [1]) { x + true }", "type mismatch: Integer + Boolean"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errorObject, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("object is not Error, got=%T(%v)", evaluated, evaluated)
+			continue
+		}
+		if errorObject.Message != tt.expectedMessage {
+			t.Errorf("wrong error message, got=%q, want=%q", errorObject.Message, tt.expectedMessage)
+		}
+	}
+}
+
+// IntegerObject checks that obj is the Integer expected.
+func IntegerObject(t *testing.T, obj object.Object, expected int64) bool {
+	result, ok := obj.(*object.Integer)
+	if !ok {
+		t.Errorf("object is not Integer. got=%T (%+v)", obj, obj)
+		return false
+	}
+
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%d, want=%d", result.Value, expected)
+		return false
+	}
+	return true
+}
+
+// FloatObject checks that obj is the Float expected.
+func FloatObject(t *testing.T, obj object.Object, expected float64) bool {
+	result, ok := obj.(*object.Float)
+	if !ok {
+		t.Errorf("object is not Float. got=%T (%+v)", obj, obj)
+		return false
+	}
+
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%g, want=%g", result.Value, expected)
+		return false
+	}
+	return true
+}
+
+// BooleanObject checks that obj is the Boolean expected.
+func BooleanObject(t *testing.T, obj object.Object, expected bool) bool {
+	result, ok := obj.(*object.Boolean)
+	if !ok {
+		t.Errorf("object is not Boolean. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if result.Value != expected {
+		t.Errorf("boolean value is wrong. got=%t, want=%t", result.Value, expected)
+		return false
+	}
+	return true
+}
+
+// NullObject checks that obj is null.
+func NullObject(t *testing.T, obj object.Object) bool {
+	if _, ok := obj.(*object.Null); !ok {
+		t.Errorf("Null object has wrong value. got=%T (%+v)", obj, obj)
+		return false
+	}
+	return true
+}
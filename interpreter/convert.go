@@ -0,0 +1,530 @@
+package interpreter
+
+import (
+	"fmt"
+	"go-interpreter/eval"
+	"go-interpreter/object"
+	"math"
+	"reflect"
+	"sort"
+)
+
+var (
+	objectType = reflect.TypeOf((*object.Object)(nil)).Elem()
+	errorType  = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// ToObject converts a Go value to an object: numbers, strings and bools to
+// their counterparts, slices and arrays to Arrays, maps and structs to Hashes,
+// functions to Builtins (see WrapFunc) and nil to null. Pointers and interfaces
+// convert what they point to, objects are passed as they are.
+//
+// Struct fields are keyed by name, or by their `interp` tag; `interp:"-"` skips a field.
+// A value that contains itself, through pointers, maps or slices, can't be
+// converted and gives an error.
+func ToObject(value interface{}) (object.Object, error) {
+	return toObject(reflect.ValueOf(value), map[visit]bool{})
+}
+
+// visit is a pointer, map or slice being converted, for toObject to find cycles.
+type visit struct {
+	ptr uintptr
+	typ reflect.Type
+	len int
+}
+
+func toObject(v reflect.Value, visiting map[visit]bool) (object.Object, error) {
+	for v.Kind() == reflect.Interface || v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return eval.NULL, nil
+		}
+		if v.Type().Implements(objectType) {
+			return v.Interface().(object.Object), nil
+		}
+		if v.Kind() == reflect.Pointer {
+			elem := v.Elem()
+			return enter(v, visiting, func() (object.Object, error) {
+				return toObject(elem, visiting)
+			})
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return eval.NULL, nil
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			return eval.TRUE, nil
+		}
+		return eval.FALSE, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &object.Integer{Value: v.Int()}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if v.Uint() > math.MaxInt64 {
+			return nil, fmt.Errorf("%d overflows Integer", v.Uint())
+		}
+		return &object.Integer{Value: int64(v.Uint())}, nil
+	case reflect.Float32, reflect.Float64:
+		return &object.Float{Value: v.Float()}, nil
+	case reflect.String:
+		return &object.String{Value: v.String()}, nil
+	case reflect.Slice:
+		return enter(v, visiting, func() (object.Object, error) {
+			return sliceToArray(v, visiting)
+		})
+	case reflect.Array:
+		return sliceToArray(v, visiting)
+	case reflect.Map:
+		return enter(v, visiting, func() (object.Object, error) {
+			return mapToHash(v, visiting)
+		})
+	case reflect.Struct:
+		return structToHash(v, visiting)
+	case reflect.Func:
+		if v.IsNil() {
+			return eval.NULL, nil
+		}
+		return WrapFunc(v.Interface())
+	default:
+		return nil, fmt.Errorf("cannot convert %s to an object", v.Type())
+	}
+}
+
+// enter converts what v points to with convert, unless the conversion is
+// already inside v: then v contains itself.
+func enter(v reflect.Value, visiting map[visit]bool, convert func() (object.Object, error)) (object.Object, error) {
+	key := visit{ptr: v.Pointer(), typ: v.Type()}
+	if v.Kind() == reflect.Slice {
+		key.len = v.Len()
+	}
+	if visiting[key] {
+		return nil, fmt.Errorf("cycle through %s", v.Type())
+	}
+
+	visiting[key] = true
+	defer delete(visiting, key)
+	return convert()
+}
+
+func sliceToArray(v reflect.Value, visiting map[visit]bool) (object.Object, error) {
+	elements := make([]object.Object, v.Len())
+	for i := range elements {
+		element, err := toObject(v.Index(i), visiting)
+		if err != nil {
+			return nil, fmt.Errorf("index %d: %w", i, err)
+		}
+		elements[i] = element
+	}
+	return &object.Array{Elements: elements}, nil
+}
+
+// mapToHash sorts the keys, Go maps having no order of their own.
+func mapToHash(v reflect.Value, visiting map[visit]bool) (object.Object, error) {
+	pairs := make([]object.HashPair, 0, v.Len())
+	iter := v.MapRange()
+	for iter.Next() {
+		key, err := toObject(iter.Key(), visiting)
+		if err != nil {
+			return nil, err
+		}
+		value, err := toObject(iter.Value(), visiting)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", key.Inspect(), err)
+		}
+		pairs = append(pairs, object.HashPair{Key: key, Value: value})
+	}
+
+	sort.Slice(pairs, func(i, j int) bool {
+		return lessKey(pairs[i].Key, pairs[j].Key)
+	})
+
+	hash := object.NewHash()
+	for _, pair := range pairs {
+		key, ok := pair.Key.(object.Hashable)
+		if !ok {
+			return nil, fmt.Errorf("unusable as hash key: %s", pair.Key.Type())
+		}
+		hash.Set(key, pair.Value)
+	}
+	return hash, nil
+}
+
+func lessKey(a object.Object, b object.Object) bool {
+	switch a := a.(type) {
+	case *object.Integer:
+		if b, ok := b.(*object.Integer); ok {
+			return a.Value < b.Value
+		}
+	case *object.String:
+		if b, ok := b.(*object.String); ok {
+			return a.Value < b.Value
+		}
+	}
+	if a.Type() != b.Type() {
+		return a.Type() < b.Type()
+	}
+	return a.Inspect() < b.Inspect()
+}
+
+func structToHash(v reflect.Value, visiting map[visit]bool) (object.Object, error) {
+	hash := object.NewHash()
+	for _, field := range structFields(v.Type()) {
+		fieldValue, err := v.FieldByIndexErr(field.index)
+		if err != nil {
+			// promoted through a nil embedded pointer
+			hash.Set(&object.String{Value: field.name}, eval.NULL)
+			continue
+		}
+
+		value, err := toObject(fieldValue, visiting)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", field.name, err)
+		}
+		hash.Set(&object.String{Value: field.name}, value)
+	}
+	return hash, nil
+}
+
+type structField struct {
+	name  string
+	index []int
+}
+
+// structFields lists the exported fields of t under the key they take in a Hash.
+func structFields(t reflect.Type) []structField {
+	var fields []structField
+	for _, field := range reflect.VisibleFields(t) {
+		if !field.IsExported() || field.Anonymous {
+			continue
+		}
+
+		name := field.Name
+		if tag, ok := field.Tag.Lookup("interp"); ok {
+			if tag == "-" {
+				continue
+			}
+			name = tag
+		}
+		fields = append(fields, structField{name: name, index: field.Index})
+	}
+	return fields
+}
+
+// settableField is v.FieldByIndex(index), allocating the nil embedded pointers
+// on the way. It fails for an embedded pointer to an unexported type, which
+// can't be allocated.
+func settableField(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				if !v.CanSet() {
+					return v, false
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+// FromObject stores obj in the value target points to, converting it the
+// opposite way of ToObject. Stored in an empty interface, Integers become
+// int64, Floats float64, Arrays []interface{}, and Hashes map[string]interface{}
+// when all their keys are Strings or else map[interface{}]interface{}.
+func FromObject(obj object.Object, target interface{}) error {
+	v := reflect.ValueOf(target)
+	if v.Kind() != reflect.Pointer || v.IsNil() {
+		return fmt.Errorf("target must be a non-nil pointer, got %T", target)
+	}
+
+	converted, err := fromObject(obj, v.Elem().Type())
+	if err != nil {
+		return err
+	}
+	v.Elem().Set(converted)
+	return nil
+}
+
+func fromObject(obj object.Object, t reflect.Type) (reflect.Value, error) {
+	emptyInterface := t.Kind() == reflect.Interface && t.NumMethod() == 0
+	if !emptyInterface && reflect.TypeOf(obj).AssignableTo(t) {
+		converted := reflect.New(t).Elem()
+		converted.Set(reflect.ValueOf(obj))
+		return converted, nil
+	}
+
+	if obj == eval.NULL {
+		switch t.Kind() {
+		case reflect.Pointer, reflect.Interface, reflect.Slice, reflect.Map:
+			return reflect.Zero(t), nil
+		}
+	}
+
+	mismatch := fmt.Errorf("cannot use %s as %s", obj.Type(), t)
+	converted := reflect.New(t).Elem()
+
+	switch t.Kind() {
+	case reflect.Interface:
+		if t.NumMethod() != 0 {
+			return converted, mismatch
+		}
+		value, err := natural(obj)
+		if err != nil {
+			return converted, err
+		}
+		if value != nil {
+			converted.Set(reflect.ValueOf(value))
+		}
+	case reflect.Bool:
+		boolean, ok := obj.(*object.Boolean)
+		if !ok {
+			return converted, mismatch
+		}
+		converted.SetBool(boolean.Value)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		integer, ok := obj.(*object.Integer)
+		if !ok {
+			return converted, mismatch
+		}
+		if converted.OverflowInt(integer.Value) {
+			return converted, fmt.Errorf("%d overflows %s", integer.Value, t)
+		}
+		converted.SetInt(integer.Value)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		integer, ok := obj.(*object.Integer)
+		if !ok {
+			return converted, mismatch
+		}
+		if integer.Value < 0 || converted.OverflowUint(uint64(integer.Value)) {
+			return converted, fmt.Errorf("%d overflows %s", integer.Value, t)
+		}
+		converted.SetUint(uint64(integer.Value))
+	case reflect.Float32, reflect.Float64:
+		switch number := obj.(type) {
+		case *object.Float:
+			converted.SetFloat(number.Value)
+		case *object.Integer:
+			converted.SetFloat(float64(number.Value))
+		default:
+			return converted, mismatch
+		}
+	case reflect.String:
+		str, ok := obj.(*object.String)
+		if !ok {
+			return converted, mismatch
+		}
+		converted.SetString(str.Value)
+	case reflect.Slice, reflect.Array:
+		array, ok := obj.(*object.Array)
+		if !ok {
+			return converted, mismatch
+		}
+		if t.Kind() == reflect.Array && t.Len() != len(array.Elements) {
+			return converted, fmt.Errorf("cannot use Array of %d elements as %s", len(array.Elements), t)
+		}
+		if t.Kind() == reflect.Slice {
+			converted = reflect.MakeSlice(t, len(array.Elements), len(array.Elements))
+		}
+		for i, element := range array.Elements {
+			value, err := fromObject(element, t.Elem())
+			if err != nil {
+				return converted, fmt.Errorf("index %d: %w", i, err)
+			}
+			converted.Index(i).Set(value)
+		}
+	case reflect.Map:
+		hash, ok := obj.(*object.Hash)
+		if !ok {
+			return converted, mismatch
+		}
+		converted = reflect.MakeMapWithSize(t, len(hash.Keys))
+		for _, pair := range hash.Ordered() {
+			key, err := fromObject(pair.Key, t.Key())
+			if err != nil {
+				return converted, fmt.Errorf("key %s: %w", pair.Key.Inspect(), err)
+			}
+			value, err := fromObject(pair.Value, t.Elem())
+			if err != nil {
+				return converted, fmt.Errorf("key %s: %w", pair.Key.Inspect(), err)
+			}
+			converted.SetMapIndex(key, value)
+		}
+	case reflect.Struct:
+		hash, ok := obj.(*object.Hash)
+		if !ok {
+			return converted, mismatch
+		}
+		for _, field := range structFields(t) {
+			value, ok := hash.Get(&object.String{Value: field.name})
+			if !ok {
+				continue
+			}
+			fieldValue, err := fromObject(value, t.FieldByIndex(field.index).Type)
+			if err != nil {
+				return converted, fmt.Errorf("field %s: %w", field.name, err)
+			}
+			if target, ok := settableField(converted, field.index); ok {
+				target.Set(fieldValue)
+			}
+		}
+	case reflect.Pointer:
+		value, err := fromObject(obj, t.Elem())
+		if err != nil {
+			return converted, err
+		}
+		converted = reflect.New(t.Elem())
+		converted.Elem().Set(value)
+	default:
+		return converted, mismatch
+	}
+
+	return converted, nil
+}
+
+// natural is the Go value an object converts to when nothing asks for a type.
+func natural(obj object.Object) (interface{}, error) {
+	switch obj := obj.(type) {
+	case *object.Null:
+		return nil, nil
+	case *object.Boolean:
+		return obj.Value, nil
+	case *object.Integer:
+		return obj.Value, nil
+	case *object.Float:
+		return obj.Value, nil
+	case *object.String:
+		return obj.Value, nil
+	case *object.Array:
+		elements := make([]interface{}, len(obj.Elements))
+		for i, element := range obj.Elements {
+			value, err := natural(element)
+			if err != nil {
+				return nil, fmt.Errorf("index %d: %w", i, err)
+			}
+			elements[i] = value
+		}
+		return elements, nil
+	case *object.Hash:
+		return naturalHash(obj)
+	default:
+		return obj, nil
+	}
+}
+
+func naturalHash(hash *object.Hash) (interface{}, error) {
+	stringKeys := true
+	for _, pair := range hash.Pairs {
+		if _, ok := pair.Key.(*object.String); !ok {
+			stringKeys = false
+		}
+	}
+
+	byString := make(map[string]interface{}, len(hash.Pairs))
+	byAny := make(map[interface{}]interface{}, len(hash.Pairs))
+	for _, pair := range hash.Pairs {
+		value, err := natural(pair.Value)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", pair.Key.Inspect(), err)
+		}
+
+		if stringKeys {
+			byString[pair.Key.(*object.String).Value] = value
+			continue
+		}
+		key, _ := natural(pair.Key)
+		byAny[key] = value
+	}
+
+	if stringKeys {
+		return byString, nil
+	}
+	return byAny, nil
+}
+
+// WrapFunc turns a Go function into a builtin. Arguments are converted with
+// FromObject and checked against the parameters, results with ToObject. The
+// function may return nothing, a value, an error, or a value and an error; a
+// non-nil error, like a panic, is raised in the script, where it can be caught.
+//
+// Script functions can't be converted to Go funcs, so a parameter of func type
+// only takes null. Take an object.Object to receive them, and call them back
+// with eval.ApplyContext.
+func WrapFunc(fn interface{}) (*object.Builtin, error) {
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func || v.IsNil() {
+		return nil, fmt.Errorf("cannot wrap %T, expected a function", fn)
+	}
+
+	t := v.Type()
+	returnsError := t.NumOut() > 0 && t.Out(t.NumOut()-1) == errorType
+	values := t.NumOut()
+	if returnsError {
+		values--
+	}
+	if values > 1 {
+		return nil, fmt.Errorf("cannot wrap %s, it returns more than a value and an error", t)
+	}
+
+	return &object.Builtin{Fun: func(args ...object.Object) (result object.Object) {
+		defer func() {
+			if r := recover(); r != nil {
+				result = eval.NewError("panic: %v", r)
+			}
+		}()
+
+		in, err := wrappedArguments(t, args)
+		if err != nil {
+			return err
+		}
+
+		out := v.Call(in)
+		if returnsError {
+			if err, ok := out[len(out)-1].Interface().(error); ok && err != nil {
+				if errorObject, ok := err.(*object.Error); ok {
+					return errorObject
+				}
+				return eval.NewError("%s", err)
+			}
+		}
+		if values == 0 {
+			return eval.NULL
+		}
+
+		result, convertError := toObject(out[0], map[visit]bool{})
+		if convertError != nil {
+			return eval.NewError("cannot convert result: %s", convertError)
+		}
+		return result
+	}}, nil
+}
+
+func wrappedArguments(t reflect.Type, args []object.Object) ([]reflect.Value, *object.Error) {
+	fixed := t.NumIn()
+	if t.IsVariadic() {
+		fixed--
+		if len(args) < fixed {
+			return nil, eval.NewError("wrong number of arguments, got=%d, want at least %d", len(args), fixed)
+		}
+	} else if len(args) != fixed {
+		return nil, eval.NewError("wrong number of arguments, got=%d, want=%d", len(args), fixed)
+	}
+
+	in := make([]reflect.Value, len(args))
+	for i, arg := range args {
+		parameter := t.In(min(i, t.NumIn()-1))
+		if t.IsVariadic() && i >= fixed {
+			parameter = parameter.Elem()
+		}
+
+		value, err := fromObject(arg, parameter)
+		if err != nil {
+			return nil, eval.NewError("argument %d: %s", i+1, err)
+		}
+		in[i] = value
+	}
+	return in, nil
+}
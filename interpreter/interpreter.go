@@ -0,0 +1,158 @@
+package interpreter
+
+import (
+	"context"
+	"fmt"
+	"go-interpreter/eval"
+	"go-interpreter/lexer"
+	"go-interpreter/object"
+	"go-interpreter/parser"
+	"go-interpreter/resolver"
+	"strings"
+)
+
+// Interpreter runs scripts for a Go program. Globals and registered builtins
+// belong to the instance and carry over from one Run to the next.
+type Interpreter struct {
+	env    *object.Environment
+	limits eval.Limits
+}
+
+type Option func(*Interpreter)
+
+// WithLimits bounds every Run and Call of the interpreter, see eval.Limits.
+func WithLimits(limits eval.Limits) Option {
+	return func(i *Interpreter) {
+		i.limits = limits
+	}
+}
+
+// WithBuiltin registers a builtin when the interpreter is created, see RegisterBuiltin.
+func WithBuiltin(name string, fn object.BuiltinFunction) Option {
+	return func(i *Interpreter) {
+		i.RegisterBuiltin(name, fn)
+	}
+}
+
+func New(opts ...Option) *Interpreter {
+	i := &Interpreter{env: object.NewEnvironment()}
+	for _, opt := range opts {
+		opt(i)
+	}
+	return i
+}
+
+// SourceError lists what is wrong with a source before it runs: syntax errors,
+// or else the variables it uses without declaring them.
+type SourceError struct {
+	Errors []error
+}
+
+func (e *SourceError) Error() string {
+	messages := make([]string, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		messages = append(messages, err.Error())
+	}
+	return strings.Join(messages, "\n")
+}
+
+// Run runs src and returns the value of its last statement. An error the script
+// doesn't catch is returned as an *object.Error.
+func (i *Interpreter) Run(src string) (object.Object, error) {
+	return i.RunContext(context.Background(), src)
+}
+
+// RunContext is Run, stopping once ctx is done.
+func (i *Interpreter) RunContext(ctx context.Context, src string) (object.Object, error) {
+	parsr := parser.New(lexer.New(src))
+	program := parsr.ParseProgram()
+	if len(parsr.Errors()) != 0 {
+		sourceError := &SourceError{}
+		for _, err := range parsr.Errors() {
+			sourceError.Errors = append(sourceError.Errors, err)
+		}
+		return nil, sourceError
+	}
+
+	if errors := resolver.Resolve(program, i.defined); len(errors) != 0 {
+		sourceError := &SourceError{}
+		for _, err := range errors {
+			sourceError.Errors = append(sourceError.Errors, err)
+		}
+		return nil, sourceError
+	}
+
+	return result(eval.EvalContext(ctx, program, i.env, i.limits))
+}
+
+// Call calls the function or builtin name with args.
+func (i *Interpreter) Call(name string, args ...object.Object) (object.Object, error) {
+	return i.CallContext(context.Background(), name, args...)
+}
+
+// CallContext is Call, stopping once ctx is done.
+func (i *Interpreter) CallContext(ctx context.Context, name string, args ...object.Object) (object.Object, error) {
+	function, ok := i.Get(name)
+	if !ok {
+		return nil, fmt.Errorf("function not found: %s", name)
+	}
+
+	switch function.(type) {
+	case *object.Function, *object.Builtin:
+		return result(eval.ApplyContext(ctx, name, function, args, i.env, i.limits))
+	default:
+		return nil, fmt.Errorf("not a function: %s is %s", name, function.Type())
+	}
+}
+
+// Set declares the global name, or changes its value.
+func (i *Interpreter) Set(name string, value object.Object) {
+	i.env.Set(name, value)
+}
+
+// Get returns the global name, falling back to the builtins like scripts do.
+func (i *Interpreter) Get(name string) (object.Object, bool) {
+	if value, ok := i.env.Get(name); ok {
+		return value, true
+	}
+
+	builtin, ok := eval.LookupBuiltin(name)
+	if !ok {
+		return nil, false
+	}
+	return builtin, true
+}
+
+// RegisterBuiltin makes fn callable as name by the scripts of this interpreter
+// only. It takes the place of a builtin or global of the same name.
+func (i *Interpreter) RegisterBuiltin(name string, fn object.BuiltinFunction) {
+	i.env.Set(name, &object.Builtin{Fun: fn})
+}
+
+// RegisterFunc is RegisterBuiltin for a Go function, wrapped with WrapFunc.
+func (i *Interpreter) RegisterFunc(name string, fn interface{}) error {
+	builtin, err := WrapFunc(fn)
+	if err != nil {
+		return err
+	}
+	i.env.Set(name, builtin)
+	return nil
+}
+
+func (i *Interpreter) defined(name string) bool {
+	_, ok := i.Get(name)
+	return ok
+}
+
+// result splits what the evaluator returns into a value and an error, programs
+// without a value giving null.
+func result(obj object.Object) (object.Object, error) {
+	switch obj := obj.(type) {
+	case nil:
+		return eval.NULL, nil
+	case *object.Error:
+		return nil, obj
+	default:
+		return obj, nil
+	}
+}
@@ -0,0 +1,487 @@
+package interpreter
+
+import (
+	"context"
+	"errors"
+	"go-interpreter/eval"
+	"go-interpreter/object"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 + 2", "3"},
+		{"var x = 5", "null"},
+		{"fun add(a, b) { a + b }; add(2, 3)", "5"},
+		{"len(\"four\")", "4"},
+	}
+
+	for _, tt := range tests {
+		result, err := New().Run(tt.input)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %s", tt.input, err)
+			continue
+		}
+		if result.Inspect() != tt.expected {
+			t.Errorf("%q: wrong result, got=%q, want=%q", tt.input, result.Inspect(), tt.expected)
+		}
+	}
+}
+
+func TestRunKeepsGlobals(t *testing.T) {
+	interp := New()
+	if _, err := interp.Run("var count = 1; fun bump() { count += 1 }"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	result, err := interp.Run("bump(); bump(); count")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if result.Inspect() != "3" {
+		t.Errorf("wrong result, got=%q", result.Inspect())
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"var = 1", "1:5: Expected next token to be \"IDENTIFIER\", got \"=\" instead"},
+		{"missing + 1", "1:1: use of undeclared variable: missing"},
+		{"1 / 0", "Error at 1:3: division by zero: 1 / 0"},
+	}
+
+	for _, tt := range tests {
+		_, err := New().Run(tt.input)
+		if err == nil {
+			t.Errorf("%q: expected an error", tt.input)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("%q: wrong error, got=%q, want=%q", tt.input, err.Error(), tt.expected)
+		}
+	}
+
+	_, err := New().Run("throw \"boom\"")
+	var errorObject *object.Error
+	if !errors.As(err, &errorObject) || errorObject.Kind != object.THROWN_ERROR {
+		t.Errorf("uncaught error is not an *object.Error, got=%T(%v)", err, err)
+	}
+
+	_, err = New().Run("x +")
+	var sourceError *SourceError
+	if !errors.As(err, &sourceError) {
+		t.Errorf("syntax error is not a *SourceError, got=%T(%v)", err, err)
+	}
+}
+
+func TestCall(t *testing.T) {
+	interp := New()
+	if _, err := interp.Run("fun greet(name, greeting = \"hello\") { greeting + \" \" + name }"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	result, err := interp.Call("greet", &object.String{Value: "world"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if result.Inspect() != "hello world" {
+		t.Errorf("wrong result, got=%q", result.Inspect())
+	}
+
+	result, err = interp.Call("len", &object.String{Value: "abc"})
+	if err != nil || result.Inspect() != "3" {
+		t.Errorf("calling a builtin failed, got=%v, %v", result, err)
+	}
+
+	interp.Set("number", &object.Integer{Value: 1})
+	interp.RegisterBuiltin("boom", func(args ...object.Object) object.Object {
+		return args[len(args)]
+	})
+
+	tests := []struct {
+		name     string
+		args     []object.Object
+		expected string
+	}{
+		{"nope", nil, "function not found: nope"},
+		{"greet", nil, "Error: wrong number of arguments to `greet`, got=0, want=1 to 2"},
+		{"number", nil, "not a function: number is Integer"},
+		{"boom", nil, "Error: internal error: runtime error: index out of range [0] with length 0"},
+	}
+
+	for _, tt := range tests {
+		_, err := interp.Call(tt.name, tt.args...)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("%s: wrong error, got=%v, want=%q", tt.name, err, tt.expected)
+		}
+	}
+
+	_, err = interp.Call("boom")
+	var errorObject *object.Error
+	if !errors.As(err, &errorObject) || errorObject.Kind != object.RUNTIME_ERROR {
+		t.Errorf("panic not raised as a runtime error, got=%#v", err)
+	}
+}
+
+func TestSetAndGet(t *testing.T) {
+	interp := New()
+	interp.Set("limit", &object.Integer{Value: 10})
+
+	result, err := interp.Run("limit = limit * 2; limit + 1")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if result.Inspect() != "21" {
+		t.Errorf("wrong result, got=%q", result.Inspect())
+	}
+
+	value, ok := interp.Get("limit")
+	if !ok || value.Inspect() != "20" {
+		t.Errorf("wrong global, got=%v", value)
+	}
+
+	if _, ok := interp.Get("undefined"); ok {
+		t.Errorf("undefined global found")
+	}
+}
+
+func TestRegisterBuiltin(t *testing.T) {
+	var logged []string
+	logger := New()
+	logger.RegisterBuiltin("log", func(args ...object.Object) object.Object {
+		for _, arg := range args {
+			logged = append(logged, arg.Inspect())
+		}
+		return eval.NULL
+	})
+
+	if _, err := logger.Run("log(1, \"two\"); fun f() { log(3) }; f()"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if strings.Join(logged, ",") != "1,two,3" {
+		t.Errorf("builtin got wrong arguments, got=%v", logged)
+	}
+
+	// builtins belong to the interpreter they were registered with
+	if _, err := New().Run("log(1)"); err == nil || err.Error() != "1:1: use of undeclared variable: log" {
+		t.Errorf("builtin leaked to another interpreter, got=%v", err)
+	}
+
+	double := New(WithBuiltin("double", func(args ...object.Object) object.Object {
+		return &object.Integer{Value: args[0].(*object.Integer).Value * 2}
+	}))
+	result, err := double.Run("double(21)")
+	if err != nil || result.Inspect() != "42" {
+		t.Errorf("builtin from option failed, got=%v, %v", result, err)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	interp := New(WithLimits(eval.Limits{MaxSteps: 1000}))
+	_, err := interp.Run("while (true) { 1 }")
+
+	var errorObject *object.Error
+	if !errors.As(err, &errorObject) || errorObject.Kind != object.LIMIT_ERROR {
+		t.Fatalf("limit not enforced, got=%v", err)
+	}
+
+	if _, err := interp.Run("fun spin() { while (true) { 1 } }"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	_, err = interp.Call("spin")
+	if !errors.As(err, &errorObject) || errorObject.Kind != object.LIMIT_ERROR {
+		t.Errorf("limit not enforced on Call, got=%v", err)
+	}
+
+	// recursion stops at the default depth instead of overflowing the Go stack
+	_, err = New().Run("fun r() { r() } r()")
+	if !errors.As(err, &errorObject) || errorObject.Kind != object.LIMIT_ERROR {
+		t.Errorf("default call depth not enforced, got=%v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = New().RunContext(ctx, "while (true) { 1 }")
+	if err == nil || !strings.Contains(err.Error(), "evaluation timed out") {
+		t.Errorf("context not honoured, got=%v", err)
+	}
+}
+
+type point struct {
+	X, Y   int
+	Label  string `interp:"label"`
+	hidden bool
+	Skip   string `interp:"-"`
+}
+
+type Inner struct {
+	Z int
+}
+
+type outer struct {
+	*Inner
+	Y int
+}
+
+type node struct {
+	Value int
+	Next  *node
+}
+
+func TestToObject(t *testing.T) {
+	tests := []struct {
+		value    interface{}
+		expected string
+	}{
+		{nil, "null"},
+		{true, "true"},
+		{int8(-3), "-3"},
+		{uint16(7), "7"},
+		{2.5, "2.5"},
+		{"text", "text"},
+		{[]int{1, 2}, "[1, 2]"},
+		{[2]string{"a", "b"}, "[a, b]"},
+		{[]int(nil), "[]"},
+		{map[string]int{"b": 2, "a": 1}, "{a: 1, b: 2}"},
+		{map[int]bool{10: true, 2: false}, "{2: false, 10: true}"},
+		{point{X: 1, Y: 2, Label: "p", Skip: "no"}, "{X: 1, Y: 2, label: p}"},
+		{&point{X: 3}, "{X: 3, Y: 0, label: }"},
+		{(*point)(nil), "null"},
+		{(func())(nil), "null"},
+		{outer{Y: 1}, "{Z: null, Y: 1}"},
+		{outer{Inner: &Inner{Z: 2}, Y: 1}, "{Z: 2, Y: 1}"},
+		{&object.Integer{Value: 4}, "4"},
+	}
+
+	for _, tt := range tests {
+		obj, err := ToObject(tt.value)
+		if err != nil {
+			t.Errorf("%#v: unexpected error: %s", tt.value, err)
+			continue
+		}
+		if obj.Inspect() != tt.expected {
+			t.Errorf("%#v: wrong object, got=%q, want=%q", tt.value, obj.Inspect(), tt.expected)
+		}
+	}
+
+	errorTests := []struct {
+		value    interface{}
+		expected string
+	}{
+		{uint64(1 << 63), "9223372036854775808 overflows Integer"},
+		{make(chan int), "cannot convert chan int to an object"},
+		{[]interface{}{1, complex(1, 2)}, "index 1: cannot convert complex128 to an object"},
+	}
+
+	for _, tt := range errorTests {
+		_, err := ToObject(tt.value)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("%#v: wrong error, got=%v, want=%q", tt.value, err, tt.expected)
+		}
+	}
+
+	looped := &node{Value: 1}
+	looped.Next = &node{Value: 2, Next: looped}
+	selfMap := map[string]interface{}{}
+	selfMap["self"] = selfMap
+	selfSlice := []interface{}{1, nil}
+	selfSlice[1] = selfSlice
+	shared := &node{Value: 3}
+
+	cycleTests := []struct {
+		name     string
+		value    interface{}
+		expected string
+	}{
+		{"pointer", looped, "field Next: field Next: cycle through *interpreter.node"},
+		{"map", selfMap, "key self: cycle through map[string]interface {}"},
+		{"slice", selfSlice, "index 1: cycle through []interface {}"},
+		// the same pointer twice is no cycle
+		{"shared", []*node{shared, shared}, ""},
+	}
+
+	for _, tt := range cycleTests {
+		message := ""
+		if _, err := ToObject(tt.value); err != nil {
+			message = err.Error()
+		}
+		if message != tt.expected {
+			t.Errorf("%s: wrong error, got=%q, want=%q", tt.name, message, tt.expected)
+		}
+	}
+}
+
+func TestFromObject(t *testing.T) {
+	interp := New()
+	if err := interp.RegisterFunc("noop", func() {}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	run := func(input string) object.Object {
+		result, err := interp.Run(input)
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %s", input, err)
+		}
+		return result
+	}
+
+	var number int
+	if err := FromObject(run("40 + 2"), &number); err != nil || number != 42 {
+		t.Errorf("int conversion failed, got=%d, %v", number, err)
+	}
+
+	var ratio float32
+	if err := FromObject(run("3"), &ratio); err != nil || ratio != 3 {
+		t.Errorf("float conversion failed, got=%v, %v", ratio, err)
+	}
+
+	var names []string
+	if err := FromObject(run("[\"a\", \"b\"]"), &names); err != nil || strings.Join(names, ",") != "a,b" {
+		t.Errorf("slice conversion failed, got=%v, %v", names, err)
+	}
+
+	var counts map[string]int
+	if err := FromObject(run("{\"a\": 1, \"b\": 2}"), &counts); err != nil || counts["a"] != 1 || counts["b"] != 2 {
+		t.Errorf("map conversion failed, got=%v, %v", counts, err)
+	}
+
+	var p *point
+	if err := FromObject(run("{\"X\": 1, \"label\": \"origin\", \"other\": true}"), &p); err != nil || p == nil || p.X != 1 || p.Label != "origin" {
+		t.Errorf("struct conversion failed, got=%+v, %v", p, err)
+	}
+
+	var embedded outer
+	if err := FromObject(run("{\"Z\": 2, \"Y\": 1}"), &embedded); err != nil || embedded.Inner == nil || embedded.Z != 2 || embedded.Y != 1 {
+		t.Errorf("embedded struct conversion failed, got=%+v, %v", embedded, err)
+	}
+
+	var any interface{}
+	if err := FromObject(run("[1, 2.5, \"s\", noop(), {\"k\": true}, {1: 2}]"), &any); err != nil {
+		t.Fatalf("interface conversion failed: %s", err)
+	}
+	elements := any.([]interface{})
+	if elements[0] != int64(1) || elements[1] != 2.5 || elements[2] != "s" || elements[3] != nil {
+		t.Errorf("wrong natural values, got=%#v", elements)
+	}
+	if hash, ok := elements[4].(map[string]interface{}); !ok || hash["k"] != true {
+		t.Errorf("wrong hash with string keys, got=%#v", elements[4])
+	}
+	if hash, ok := elements[5].(map[interface{}]interface{}); !ok || hash[int64(1)] != int64(2) {
+		t.Errorf("wrong hash with other keys, got=%#v", elements[5])
+	}
+
+	var obj object.Object
+	if err := FromObject(run("\"kept\""), &obj); err != nil || obj.Inspect() != "kept" {
+		t.Errorf("object target failed, got=%v, %v", obj, err)
+	}
+
+	var small int8
+	var pair [2]int
+	var flag bool
+	errorTests := []struct {
+		input    string
+		target   interface{}
+		expected string
+	}{
+		{"300", &small, "300 overflows int8"},
+		{"[1, 2, 3]", &pair, "cannot use Array of 3 elements as [2]int"},
+		{"1", &flag, "cannot use Integer as bool"},
+		{"[1, \"x\"]", &names, "index 0: cannot use Integer as string"},
+		{"1", number, "target must be a non-nil pointer, got int"},
+	}
+
+	for _, tt := range errorTests {
+		err := FromObject(run(tt.input), tt.target)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("%q: wrong error, got=%v, want=%q", tt.input, err, tt.expected)
+		}
+	}
+}
+
+func TestRegisterFunc(t *testing.T) {
+	interp := New()
+	funcs := map[string]interface{}{
+		"repeat": func(s string, n int) (string, error) {
+			if n < 0 {
+				return "", errors.New("negative count")
+			}
+			return strings.Repeat(s, n), nil
+		},
+		"sum": func(numbers ...int) int {
+			total := 0
+			for _, n := range numbers {
+				total += n
+			}
+			return total
+		},
+		"describe": func(p point) map[string]int { return map[string]int{"sum": p.X + p.Y} },
+		"noop":     func() {},
+		"explode":  func() int { panic("boom") },
+		"apply":    func(f func(int) int, x int) int { return f(x) },
+		"call": func(f object.Object, x int) object.Object {
+			args := []object.Object{&object.Integer{Value: int64(x)}}
+			return eval.ApplyContext(context.Background(), "f", f, args, object.NewEnvironment(), eval.Limits{})
+		},
+	}
+	for name, fn := range funcs {
+		if err := interp.RegisterFunc(name, fn); err != nil {
+			t.Fatalf("%s: unexpected error: %s", name, err)
+		}
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"repeat(\"ab\", 3)", "ababab"},
+		{"sum()", "0"},
+		{"sum(1, 2, 3)", "6"},
+		{"describe({\"X\": 1, \"Y\": 2})", "{sum: 3}"},
+		{"noop()", "null"},
+		{"try { repeat(\"a\", -1) } catch (e) { e[\"message\"] }", "negative count"},
+		{"try { explode() } catch (e) { e[\"message\"] }", "panic: boom"},
+		{"call(fun(x) { x * 2 }, 21)", "42"},
+	}
+
+	for _, tt := range tests {
+		result, err := interp.Run(tt.input)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %s", tt.input, err)
+			continue
+		}
+		if result.Inspect() != tt.expected {
+			t.Errorf("%q: wrong result, got=%q, want=%q", tt.input, result.Inspect(), tt.expected)
+		}
+	}
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{"repeat(\"a\")", "Error at 1:7: wrong number of arguments, got=1, want=2"},
+		{"repeat(1, 2)", "Error at 1:7: argument 1: cannot use Integer as string"},
+		{"sum(1, \"2\")", "Error at 1:4: argument 2: cannot use String as int"},
+		{"apply(fun(x) { x }, 1)", "Error at 1:6: argument 1: cannot use Function as func(int) int"},
+	}
+
+	for _, tt := range errorTests {
+		_, err := interp.Run(tt.input)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("%q: wrong error, got=%v, want=%q", tt.input, err, tt.expected)
+		}
+	}
+
+	if err := interp.RegisterFunc("bad", 1); err == nil {
+		t.Errorf("expected an error wrapping a non-function")
+	}
+	if err := interp.RegisterFunc("bad", func() (int, int) { return 0, 0 }); err == nil {
+		t.Errorf("expected an error wrapping a function with two results")
+	}
+}
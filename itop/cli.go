@@ -0,0 +1,286 @@
+package itop
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"go-interpreter/ast"
+	"go-interpreter/eval"
+	"go-interpreter/lexer"
+	"go-interpreter/object"
+	"go-interpreter/parser"
+	"go-interpreter/resolver"
+	"io"
+	"os"
+	"strings"
+)
+
+// Exit codes of Main.
+const (
+	ExitOK = 0
+	// ExitError is for programs with errors, or failing while they run
+	ExitError = 1
+	ExitUsage = 2
+)
+
+const usage = `usage: itop [-engine eval|vm] [command] [arguments]
+
+commands:
+  run FILE [ARGS...]       run a script, ARGS are given to it as args
+  eval -e EXPR [ARGS...]   evaluate EXPR and print its value
+  check FILE...            report the errors of scripts without running them
+  repl                     start the interactive prompt, the default
+
+itop FILE [ARGS...] is short for itop run FILE [ARGS...], so scripts can start
+with #!/usr/bin/env itop
+
+In the repl, an entry with brackets or a string left open goes on in the next
+lines, .break on a line of its own cancels it.
+`
+
+type cli struct {
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+	engine string
+}
+
+// Main runs the itop command with args, the command line without the program
+// name, and returns its exit code.
+func Main(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	c := &cli{stdin: stdin, stdout: stdout, stderr: stderr, engine: "eval"}
+
+	flags := c.flags("itop")
+	if err := flags.Parse(args); err != nil {
+		return flagError(err)
+	}
+
+	args = flags.Args()
+	if len(args) == 0 {
+		return c.repl(nil)
+	}
+
+	switch args[0] {
+	case "run":
+		return c.run(args[1:])
+	case "eval":
+		return c.eval(args[1:])
+	case "check":
+		return c.check(args[1:])
+	case "repl":
+		return c.repl(args[1:])
+	case "help":
+		fmt.Fprint(stdout, usage)
+		return ExitOK
+	default:
+		return c.run(args)
+	}
+}
+
+func (c *cli) run(args []string) int {
+	flags := c.flags("run")
+	if err := flags.Parse(args); err != nil {
+		return flagError(err)
+	}
+	if flags.NArg() == 0 {
+		return c.usageError("run: missing script file")
+	}
+
+	file := flags.Arg(0)
+	src, err := os.ReadFile(file)
+	if err != nil {
+		fmt.Fprintf(c.stderr, "itop: %s\n", err)
+		return ExitError
+	}
+
+	engine, err := c.newEngine(flags.Args()[1:])
+	if err != nil {
+		return c.usageError(err.Error())
+	}
+	return c.execute(engine, file, string(src), false)
+}
+
+func (c *cli) eval(args []string) int {
+	flags := c.flags("eval")
+	expression := flags.String("e", "", "the expression to evaluate")
+	if err := flags.Parse(args); err != nil {
+		return flagError(err)
+	}
+	if *expression == "" {
+		return c.usageError("eval: missing -e EXPR")
+	}
+
+	engine, err := c.newEngine(flags.Args())
+	if err != nil {
+		return c.usageError(err.Error())
+	}
+	return c.execute(engine, "", *expression, true)
+}
+
+func (c *cli) check(args []string) int {
+	flags := c.flags("check")
+	if err := flags.Parse(args); err != nil {
+		return flagError(err)
+	}
+	if flags.NArg() == 0 {
+		return c.usageError("check: missing script files")
+	}
+
+	code := ExitOK
+	for _, file := range flags.Args() {
+		src, err := os.ReadFile(file)
+		if err != nil {
+			fmt.Fprintf(c.stderr, "itop: %s\n", err)
+			code = ExitError
+			continue
+		}
+
+		engine, err := c.newEngine(nil)
+		if err != nil {
+			return c.usageError(err.Error())
+		}
+		if _, errs := load(file, string(src), engine.Defined); len(errs) != 0 {
+			c.printErrors(errs)
+			code = ExitError
+		}
+	}
+	return code
+}
+
+func (c *cli) repl(args []string) int {
+	flags := c.flags("repl")
+	if err := flags.Parse(args); err != nil {
+		return flagError(err)
+	}
+	if flags.NArg() != 0 {
+		return c.usageError("repl: unexpected arguments")
+	}
+
+	engine, err := c.newEngine(nil)
+	if err != nil {
+		return c.usageError(err.Error())
+	}
+
+	fmt.Fprintf(c.stdout, "Welcome to itop!\n")
+	StartEngine(c.stdin, c.stdout, engine)
+	return ExitOK
+}
+
+// execute runs the script src, read from file, reporting its errors on stderr.
+// With printResult, the value of the script is written to stdout.
+func (c *cli) execute(engine Engine, file string, src string, printResult bool) int {
+	program, errs := load(file, src, engine.Defined)
+	if len(errs) != 0 {
+		c.printErrors(errs)
+		return ExitError
+	}
+
+	result := engine.Run(program)
+	if errorObject, ok := result.(*object.Error); ok {
+		fmt.Fprintln(c.stderr, errorObject.Inspect())
+		if len(errorObject.Stack) > 0 {
+			fmt.Fprintln(c.stderr, errorObject.StackTrace())
+		}
+		return ExitError
+	}
+
+	if printResult && result != nil && result != eval.NULL {
+		fmt.Fprintln(c.stdout, result.Inspect())
+	}
+	return ExitOK
+}
+
+// load parses and resolves the script src, read from file, skipping a #! line
+// at its start. It reports every syntax error, or else every use of an
+// undeclared variable.
+func load(file string, src string, defined func(name string) bool) (*ast.Program, []error) {
+	if strings.HasPrefix(src, "#!") {
+		// keep the newline, so positions still match the lines of the file
+		if end := strings.IndexByte(src, '\n'); end >= 0 {
+			src = src[end:]
+		} else {
+			src = ""
+		}
+	}
+
+	var errs []error
+	parsr := parser.New(lexer.NewFile(file, src))
+	program := parsr.ParseProgram()
+	for _, err := range parsr.Errors() {
+		errs = append(errs, err)
+	}
+	if len(errs) != 0 {
+		return nil, errs
+	}
+
+	for _, err := range resolver.Resolve(program, defined) {
+		errs = append(errs, err)
+	}
+	return program, errs
+}
+
+// newEngine creates the selected engine, with the globals scripts get from the
+// command line: args, and print.
+func (c *cli) newEngine(args []string) (Engine, error) {
+	var engine Engine
+	switch c.engine {
+	case "eval":
+		engine = NewEvalEngine()
+	case "vm":
+		engine = NewVMEngine()
+	default:
+		return nil, fmt.Errorf("unknown engine %q, expected eval or vm", c.engine)
+	}
+
+	elements := make([]object.Object, len(args))
+	for i, arg := range args {
+		elements[i] = &object.String{Value: arg}
+	}
+	engine.Set("args", &object.Array{Elements: elements})
+	engine.Set("print", &object.Builtin{Fun: printTo(c.stdout)})
+
+	return engine, nil
+}
+
+// printTo is the print builtin, writing its arguments to out on a line,
+// separated by spaces.
+func printTo(out io.Writer) object.BuiltinFunction {
+	return func(args ...object.Object) object.Object {
+		values := make([]string, len(args))
+		for i, arg := range args {
+			values[i] = arg.Inspect()
+		}
+		fmt.Fprintln(out, strings.Join(values, " "))
+		return eval.NULL
+	}
+}
+
+// flags is the flag set of a command, all of them taking -engine.
+func (c *cli) flags(name string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(c.stderr)
+	flags.Usage = func() {
+		fmt.Fprint(c.stderr, usage)
+	}
+	flags.StringVar(&c.engine, "engine", c.engine, "how to run programs: eval or vm")
+	return flags
+}
+
+func (c *cli) usageError(message string) int {
+	fmt.Fprintf(c.stderr, "itop: %s\n\n%s", message, usage)
+	return ExitUsage
+}
+
+func (c *cli) printErrors(errs []error) {
+	for _, err := range errs {
+		fmt.Fprintln(c.stderr, err)
+	}
+}
+
+// flagError is the exit code once a flag set failed to parse, and printed why.
+func flagError(err error) int {
+	if errors.Is(err, flag.ErrHelp) {
+		return ExitOK
+	}
+	return ExitUsage
+}
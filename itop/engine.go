@@ -0,0 +1,79 @@
+package itop
+
+import (
+	"go-interpreter/ast"
+	"go-interpreter/compiler"
+	"go-interpreter/eval"
+	"go-interpreter/object"
+	"go-interpreter/vm"
+)
+
+// Engine runs the programs typed into itop, keeping what they define for the next ones.
+type Engine interface {
+	Run(program *ast.Program) object.Object
+	// Defined reports whether name is a global the engine already knows
+	Defined(name string) bool
+	// Set declares the global name with value, for programs to come
+	Set(name string, value object.Object)
+}
+
+type evalEngine struct {
+	env *object.Environment
+}
+
+// NewEvalEngine runs programs with the tree-walking evaluator.
+func NewEvalEngine() Engine {
+	return &evalEngine{env: object.NewEnvironment()}
+}
+
+func (e *evalEngine) Run(program *ast.Program) object.Object {
+	return eval.SafeEval(program, e.env)
+}
+
+func (e *evalEngine) Defined(name string) bool {
+	_, ok := e.env.Get(name)
+	_, builtin := eval.LookupBuiltin(name)
+	return ok || builtin
+}
+
+func (e *evalEngine) Set(name string, value object.Object) {
+	e.env.Set(name, value)
+}
+
+type vmEngine struct {
+	symbolTable *compiler.SymbolTable
+	globals     []object.Object
+}
+
+// NewVMEngine compiles programs to bytecode and runs them on the virtual machine.
+func NewVMEngine() Engine {
+	return &vmEngine{symbolTable: compiler.NewSymbolTable()}
+}
+
+func (e *vmEngine) Run(program *ast.Program) object.Object {
+	// every program gets its own constants, the functions of earlier ones keep theirs
+	comp := compiler.NewWithState(e.symbolTable, []object.Object{})
+	if err := comp.Compile(program); err != nil {
+		return eval.NewError("compile error: %s", err)
+	}
+
+	bytecode := comp.Bytecode()
+	machine := vm.NewWithGlobals(bytecode, e.globals)
+	result := machine.Run()
+	e.globals = machine.Globals()
+	return result
+}
+
+func (e *vmEngine) Defined(name string) bool {
+	_, ok := e.symbolTable.Resolve(name)
+	_, builtin := eval.LookupBuiltin(name)
+	return ok || builtin
+}
+
+func (e *vmEngine) Set(name string, value object.Object) {
+	symbol := e.symbolTable.Define(name)
+	if missing := symbol.Index + 1 - len(e.globals); missing > 0 {
+		e.globals = append(e.globals, make([]object.Object, missing)...)
+	}
+	e.globals[symbol.Index] = value
+}
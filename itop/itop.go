@@ -3,50 +3,113 @@ package itop
 import (
 	"bufio"
 	"fmt"
-	"go-interpreter/eval"
 	"go-interpreter/lexer"
 	"go-interpreter/object"
 	"go-interpreter/parser"
+	"go-interpreter/resolver"
+	"go-interpreter/token"
 	"io"
+	"strings"
 )
 
 const PROMPT = ">> "
 
+// CONTINUATION_PROMPT asks for the rest of an entry that isn't complete yet.
+const CONTINUATION_PROMPT = ".. "
+
+// CANCEL typed on its own line throws away the entry being typed.
+const CANCEL = ".break"
+
 func Start(in io.Reader, out io.Writer) {
+	StartEngine(in, out, NewEvalEngine())
+}
+
+func StartEngine(in io.Reader, out io.Writer, engine Engine) {
 	scanner := bufio.NewScanner(in)
-	env := object.NewEnvironment()
+	entry := ""
 
 	for {
-		fmt.Fprint(out, PROMPT)
+		if entry == "" {
+			fmt.Fprint(out, PROMPT)
+		} else {
+			fmt.Fprint(out, CONTINUATION_PROMPT)
+		}
+
 		scanned := scanner.Scan()
 		if !scanned {
+			if entry != "" {
+				// run what's left, so its errors are shown
+				fmt.Fprintln(out)
+				runEntry(out, engine, entry)
+			}
 			return
 		}
 
 		line := scanner.Text()
-		lxr := lexer.New(line)
-		parsr := parser.New(lxr)
-		program := parsr.ParseProgram()
+		if strings.TrimSpace(line) == CANCEL {
+			entry = ""
+			continue
+		}
 
-		if len(parsr.Errors()) != 0 {
-			printParserErrors(out, parsr.Errors())
+		entry += line + "\n"
+		if incomplete(entry) {
 			continue
 		}
 
-		evaluated := eval.Eval(program, env)
-		if evaluated != nil {
-			fmt.Fprintf(out, "- : %s = %+v\n", evaluated.Type(), evaluated.Inspect())
+		runEntry(out, engine, entry)
+		entry = ""
+	}
+}
+
+func runEntry(out io.Writer, engine Engine, entry string) {
+	parsr := parser.New(lexer.New(entry))
+	program := parsr.ParseProgram()
+
+	if len(parsr.Errors()) != 0 {
+		printParserErrors(out, parsr.Errors())
+		return
+	}
+
+	if errors := resolver.Resolve(program, engine.Defined); len(errors) != 0 {
+		printResolverErrors(out, errors)
+		return
+	}
+
+	evaluated := engine.Run(program)
+	if evaluated != nil {
+		fmt.Fprintf(out, "- : %s = %+v\n", evaluated.Type(), evaluated.Inspect())
+		if errorObject, ok := evaluated.(*object.Error); ok && len(errorObject.Stack) > 0 {
+			fmt.Fprintln(out, errorObject.StackTrace())
+		}
+	}
+}
+
+// incomplete reports whether entry stops in the middle of a statement: inside
+// a string or block comment, or with brackets left open.
+func incomplete(entry string) bool {
+	lxr := lexer.New(entry)
+	depth := 0
+	for tok := lxr.NextToken(); tok.Type != token.EOF; tok = lxr.NextToken() {
+		switch tok.Type {
+		case token.LEFT_PAREN, token.LEFT_BRACE, token.LEFT_BRACKET:
+			depth++
+		case token.RIGHT_PAREN, token.RIGHT_BRACE, token.RIGHT_BRACKET:
+			depth--
 		}
+	}
+	return depth > 0 || lxr.Unterminated()
+}
 
-		//for tkn := lxr.NextToken(); tkn.Type != token.EOF; tkn = lxr.NextToken() {
-		//	fmt.Fprintf(out, "%+v\n", tkn)
-		//}
+func printParserErrors(out io.Writer, errors []*parser.ParseError) {
+	fmt.Fprintln(out, " parser errors:")
+	for _, err := range errors {
+		fmt.Fprintln(out, "\t"+err.Error())
 	}
 }
 
-func printParserErrors(out io.Writer, errors []string) {
-	fmt.Println(" parser errors:")
-	for _, msg := range errors {
-		fmt.Fprintln(out, "\t"+msg)
+func printResolverErrors(out io.Writer, errors []*resolver.Error) {
+	fmt.Fprintln(out, " resolver errors:")
+	for _, err := range errors {
+		fmt.Fprintln(out, "\t"+err.Error())
 	}
 }
@@ -0,0 +1,165 @@
+package itop
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCommands(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, src string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+			t.Fatalf("writing %s: %s", name, err)
+		}
+		return path
+	}
+
+	greet := write("greet.itop", "#!/usr/bin/env itop\nfun greet(name) { \"hi \" + name }\nprint(greet(args[0]), len(args))\n")
+	fail := write("fail.itop", "fun f() { 1 / 0 }\nf()\n")
+	broken := write("broken.itop", "var = 1;\nvar y = ;\nmissing\n")
+	undeclared := write("undeclared.itop", "var x = a + b\n")
+	unterminated := write("unterminated.itop", "var s = \"abc")
+
+	tests := []struct {
+		args   []string
+		stdout string
+		stderr string
+		code   int
+	}{
+		{[]string{greet, "bob", "-x"}, "hi bob 2\n", "", ExitOK},
+		{[]string{"run", greet, "ann"}, "hi ann 1\n", "", ExitOK},
+		{[]string{"-engine", "vm", "run", greet, "ann"}, "hi ann 1\n", "", ExitOK},
+		{[]string{"run", "-engine", "vm", greet, "ann"}, "hi ann 1\n", "", ExitOK},
+		{[]string{"eval", "-e", "1 + 2"}, "3\n", "", ExitOK},
+		{[]string{"eval", "-e", "args", "a", "b"}, "[a, b]\n", "", ExitOK},
+		{[]string{"eval", "-e", "var x = 1"}, "", "", ExitOK},
+		{[]string{"eval", "-e", "missing"}, "", "1:1: use of undeclared variable: missing\n", ExitError},
+		{[]string{"eval", "-e", "\"abc"}, "", "1:1: no prefix parse function for ILLEGAL found\n", ExitError},
+		{[]string{"check", greet}, "", "", ExitOK},
+		{[]string{"check", broken, undeclared}, "",
+			broken + ":1:5: Expected next token to be \"IDENTIFIER\", got \"=\" instead\n" +
+				broken + ":2:9: no prefix parse function for ; found\n" +
+				undeclared + ":1:9: use of undeclared variable: a\n" +
+				undeclared + ":1:13: use of undeclared variable: b\n",
+			ExitError},
+		{[]string{"check", unterminated}, "", unterminated + ":1:9: no prefix parse function for ILLEGAL found\n", ExitError},
+		{[]string{fail}, "", "Error at " + fail + ":1:13: division by zero: 1 / 0\n\tin `f` called at " + fail + ":2:2\n", ExitError},
+		{[]string{"-engine", "vm", fail}, "", "Error at " + fail + ":1:13: division by zero: 1 / 0\n\tin `f` called at " + fail + ":2:2\n", ExitError},
+	}
+
+	for _, tt := range tests {
+		var stdout, stderr bytes.Buffer
+		code := Main(tt.args, strings.NewReader(""), &stdout, &stderr)
+
+		if code != tt.code {
+			t.Errorf("%v: wrong exit code, got=%d, want=%d", tt.args, code, tt.code)
+		}
+		if stdout.String() != tt.stdout {
+			t.Errorf("%v: wrong stdout, got=%q, want=%q", tt.args, stdout.String(), tt.stdout)
+		}
+		if stderr.String() != tt.stderr {
+			t.Errorf("%v: wrong stderr, got=%q, want=%q", tt.args, stderr.String(), tt.stderr)
+		}
+	}
+}
+
+func TestUsageErrors(t *testing.T) {
+	tests := []struct {
+		args    []string
+		message string
+	}{
+		{[]string{"run"}, "itop: run: missing script file"},
+		{[]string{"eval"}, "itop: eval: missing -e EXPR"},
+		{[]string{"check"}, "itop: check: missing script files"},
+		{[]string{"-engine", "jit", "eval", "-e", "1"}, "itop: unknown engine \"jit\", expected eval or vm"},
+		{[]string{"-unknown"}, "flag provided but not defined: -unknown"},
+	}
+
+	for _, tt := range tests {
+		var stdout, stderr bytes.Buffer
+		code := Main(tt.args, strings.NewReader(""), &stdout, &stderr)
+
+		if code != ExitUsage {
+			t.Errorf("%v: wrong exit code, got=%d, want=%d", tt.args, code, ExitUsage)
+		}
+		if !strings.HasPrefix(stderr.String(), tt.message) || !strings.Contains(stderr.String(), "usage: itop") {
+			t.Errorf("%v: wrong stderr, got=%q", tt.args, stderr.String())
+		}
+	}
+
+	var stdout, stderr bytes.Buffer
+	if code := Main([]string{"run", "missing.itop"}, strings.NewReader(""), &stdout, &stderr); code != ExitError {
+		t.Errorf("missing file: wrong exit code, got=%d", code)
+	}
+}
+
+func TestRepl(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	code := Main(nil, strings.NewReader("var x = 20\nx + 1\n"), &stdout, &stderr)
+
+	expected := "Welcome to itop!\n>> >> - : Integer = 21\n>> "
+	if code != ExitOK || stdout.String() != expected {
+		t.Errorf("wrong repl session, got=%d, %q, want=%q", code, stdout.String(), expected)
+	}
+}
+
+func TestIncomplete(t *testing.T) {
+	tests := []struct {
+		entry    string
+		expected bool
+	}{
+		{"1 + 2\n", false},
+		{"fun add(a, b) {\n", true},
+		{"fun add(a, b) {\na + b\n}\n", false},
+		{"[1,\n2\n", true},
+		{"len(\n", true},
+		{"\"open string\n", true},
+		{"\"{ in a string\"\n", false},
+		{"// { in a comment\n", false},
+		{"/* open comment\n", true},
+		{"1 }\n", false},
+	}
+
+	for _, tt := range tests {
+		if incomplete(tt.entry) != tt.expected {
+			t.Errorf("%q: wrong incomplete, got=%t, want=%t", tt.entry, !tt.expected, tt.expected)
+		}
+	}
+}
+
+func TestReplMultiLine(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			"fun add(a, b) {\n  a + b\n}\nadd(1, 2)\n",
+			">> .. .. >> - : Integer = 3\n>> ",
+		},
+		{
+			"var s = \"two\nlines\"\nlen(s)\n",
+			">> .. >> - : Integer = 9\n>> ",
+		},
+		{
+			"[1,\n.break\n1 + 1\n",
+			">> .. >> - : Integer = 2\n>> ",
+		},
+		{
+			"[1,\n2\n",
+			">> .. .. \n parser errors:\n\t3:1: Expected next token to be \"]\", got \"EOF\" instead\n",
+		},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		StartEngine(strings.NewReader(tt.input), &out, NewEvalEngine())
+
+		if out.String() != tt.expected {
+			t.Errorf("%q: wrong session, got=%q, want=%q", tt.input, out.String(), tt.expected)
+		}
+	}
+}
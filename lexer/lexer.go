@@ -3,26 +3,64 @@ package lexer
 import (
 	"go-interpreter/token"
 	"unicode"
+	"unicode/utf8"
 )
 
 type Lexer struct {
 	input        string
 	currPosition int
 	readPosition int
-	// todo)) change to rune for utf8 support
-	currChar byte
+	currChar     rune
+
+	file   string
+	line   int
+	column int
+
+	keepComments bool
+	// unterminated is set once the input ended inside a string or block comment
+	unterminated bool
 }
 
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	return NewFile("", input)
+}
+
+// NewFile creates a lexer whose token positions are reported against the given file name.
+func NewFile(file string, input string) *Lexer {
+	l := &Lexer{input: input, file: file, line: 1}
 	l.readChar()
 	return l
 }
 
+// KeepComments makes NextToken return comments as COMMENT tokens instead of skipping them.
+func (l *Lexer) KeepComments() *Lexer {
+	l.keepComments = true
+	return l
+}
+
+// Unterminated reports whether the input read so far ended inside a string or
+// block comment, as happens with input that goes on in the next line.
+func (l *Lexer) Unterminated() bool {
+	return l.unterminated
+}
+
 func (l *Lexer) NextToken() token.Token {
 	var tok token.Token
 
 	l.eatWhitespace()
+	for l.currChar == '/' && (l.peekChar() == '/' || l.peekChar() == '*') {
+		pos := l.position()
+		comment, terminated := l.readComment()
+		if !terminated {
+			l.unterminated = true
+			return token.Token{Type: token.ILLEGAL, Literal: comment, Pos: pos}
+		}
+		if l.keepComments {
+			return token.Token{Type: token.COMMENT, Literal: comment, Pos: pos}
+		}
+		l.eatWhitespace()
+	}
+	pos := l.position()
 
 	switch l.currChar {
 	case '=':
@@ -34,9 +72,21 @@ func (l *Lexer) NextToken() token.Token {
 			tok = token.New(token.ASSIGN, string(l.currChar))
 		}
 	case '+':
-		tok = token.New(token.PLUS, string(l.currChar))
+		peeked := l.peekChar()
+		if peeked == '=' {
+			tok = token.New(token.PLUS_ASSIGN, string(l.currChar)+string(peeked))
+			l.readChar()
+		} else {
+			tok = token.New(token.PLUS, string(l.currChar))
+		}
 	case '-':
-		tok = token.New(token.MINUS, string(l.currChar))
+		peeked := l.peekChar()
+		if peeked == '=' {
+			tok = token.New(token.MINUS_ASSIGN, string(l.currChar)+string(peeked))
+			l.readChar()
+		} else {
+			tok = token.New(token.MINUS, string(l.currChar))
+		}
 	case '!':
 		peeked := l.peekChar()
 		if peeked == '=' {
@@ -46,14 +96,40 @@ func (l *Lexer) NextToken() token.Token {
 			tok = token.New(token.BANG, string(l.currChar))
 		}
 	case '*':
-		tok = token.New(token.ASTERISK, string(l.currChar))
+		peeked := l.peekChar()
+		if peeked == '=' {
+			tok = token.New(token.ASTERISK_ASSIGN, string(l.currChar)+string(peeked))
+			l.readChar()
+		} else if peeked == '*' {
+			tok = token.New(token.POWER, string(l.currChar)+string(peeked))
+			l.readChar()
+		} else {
+			tok = token.New(token.ASTERISK, string(l.currChar))
+		}
 	case '/':
-		tok = token.New(token.SLASH, string(l.currChar))
+		peeked := l.peekChar()
+		if peeked == '=' {
+			tok = token.New(token.SLASH_ASSIGN, string(l.currChar)+string(peeked))
+			l.readChar()
+		} else {
+			tok = token.New(token.SLASH, string(l.currChar))
+		}
+	case '%':
+		peeked := l.peekChar()
+		if peeked == '=' {
+			tok = token.New(token.PERCENT_ASSIGN, string(l.currChar)+string(peeked))
+			l.readChar()
+		} else {
+			tok = token.New(token.PERCENT, string(l.currChar))
+		}
 	case '<':
 		peeked := l.peekChar()
 		if peeked == '=' {
 			tok = token.New(token.LESS_EQUALS, string(l.currChar)+string(peeked))
 			l.readChar()
+		} else if peeked == '<' {
+			tok = token.New(token.SHIFT_LEFT, string(l.currChar)+string(peeked))
+			l.readChar()
 		} else {
 			tok = token.New(token.LESS_THAN, string(l.currChar))
 		}
@@ -62,13 +138,46 @@ func (l *Lexer) NextToken() token.Token {
 		if peeked == '=' {
 			tok = token.New(token.GREATER_EQUALS, string(l.currChar)+string(peeked))
 			l.readChar()
+		} else if peeked == '>' {
+			tok = token.New(token.SHIFT_RIGHT, string(l.currChar)+string(peeked))
+			l.readChar()
 		} else {
 			tok = token.New(token.GREATER_THAN, string(l.currChar))
 		}
+	case '&':
+		peeked := l.peekChar()
+		if peeked == '&' {
+			tok = token.New(token.AND, string(l.currChar)+string(peeked))
+			l.readChar()
+		} else {
+			tok = token.New(token.BIT_AND, string(l.currChar))
+		}
+	case '|':
+		peeked := l.peekChar()
+		if peeked == '|' {
+			tok = token.New(token.OR, string(l.currChar)+string(peeked))
+			l.readChar()
+		} else {
+			tok = token.New(token.BIT_OR, string(l.currChar))
+		}
+	case '^':
+		tok = token.New(token.BIT_XOR, string(l.currChar))
+	case '~':
+		tok = token.New(token.TILDE, string(l.currChar))
 	case ',':
 		tok = token.New(token.COMMA, string(l.currChar))
 	case ';':
 		tok = token.New(token.SEMICOLON, string(l.currChar))
+	case ':':
+		tok = token.New(token.COLON, string(l.currChar))
+	case '.':
+		if l.peekChar() == '.' && l.peekCharAt(1) == '.' {
+			l.readChar()
+			l.readChar()
+			tok = token.New(token.ELLIPSIS, "...")
+		} else {
+			tok = token.New(token.ILLEGAL, string(l.currChar))
+		}
 	case '(':
 		tok = token.New(token.LEFT_PAREN, string(l.currChar))
 	case ')':
@@ -81,24 +190,28 @@ func (l *Lexer) NextToken() token.Token {
 		tok = token.New(token.LEFT_BRACKET, string(l.currChar))
 	case ']':
 		tok = token.New(token.RIGHT_BRACKET, string(l.currChar))
-	case '"':
-		tok.Type = token.STRING
-		tok.Literal = l.readString('"')
-	case '`':
+	case '"', '`':
+		start := l.currPosition
+		str, terminated := l.readString(l.currChar)
+		if !terminated {
+			l.unterminated = true
+			return token.Token{Type: token.ILLEGAL, Literal: l.input[start:l.currPosition], Pos: pos}
+		}
 		tok.Type = token.STRING
-		tok.Literal = l.readString('`')
+		tok.Literal = str
 	case 0:
 		tok.Type = token.EOF
 		tok.Literal = ""
 	default:
 		switch {
-		case unicode.IsLetter(rune(l.currChar)):
+		case isLetter(l.currChar):
 			tok.Literal = l.readIdentifier()
 			tok.Type = token.LookupIdentifier(tok.Literal)
+			tok.Pos = pos
 			return tok
-		case unicode.IsDigit(rune(l.currChar)):
-			tok.Literal = l.readNumber()
-			tok.Type = token.INT
+		case isDigit(l.currChar):
+			tok.Literal, tok.Type = l.readNumber()
+			tok.Pos = pos
 			return tok
 		default:
 			tok = token.New(token.ILLEGAL, string(l.currChar))
@@ -106,43 +219,111 @@ func (l *Lexer) NextToken() token.Token {
 	}
 
 	l.readChar()
+	tok.Pos = pos
 	return tok
 }
 
+func (l *Lexer) position() token.Position {
+	return token.Position{
+		File:   l.file,
+		Line:   l.line,
+		Column: l.column,
+		Offset: l.currPosition,
+	}
+}
+
 func (l *Lexer) readChar() {
-	// todo)) update for utf8 support
+	if l.currChar == '\n' {
+		l.line++
+		l.column = 1
+	} else {
+		l.column++
+	}
+
+	width := 1
 	if l.readPosition >= len(l.input) {
 		l.currChar = 0
 	} else {
-		l.currChar = l.input[l.readPosition]
+		l.currChar, width = utf8.DecodeRuneInString(l.input[l.readPosition:])
 	}
 
 	l.currPosition = l.readPosition
-	l.readPosition++
+	l.readPosition += width
 }
 
-func (l *Lexer) peekChar() byte {
-	// todo)) update for utf8 support
+func (l *Lexer) peekChar() rune {
 	if l.readPosition >= len(l.input) {
 		return 0
 	}
-	return l.input[l.readPosition]
+	r, _ := utf8.DecodeRuneInString(l.input[l.readPosition:])
+	return r
+}
+
+// peekCharAt looks n characters past the peeked one.
+func (l *Lexer) peekCharAt(n int) rune {
+	position := l.readPosition
+	for ; n > 0 && position < len(l.input); n-- {
+		_, width := utf8.DecodeRuneInString(l.input[position:])
+		position += width
+	}
+	if position >= len(l.input) {
+		return 0
+	}
+	r, _ := utf8.DecodeRuneInString(l.input[position:])
+	return r
 }
 
 func (l *Lexer) readIdentifier() string {
 	startingPosition := l.currPosition
-	for unicode.IsLetter(rune(l.currChar)) {
+	for isLetter(l.currChar) || isDigit(l.currChar) {
 		l.readChar()
 	}
 	return l.input[startingPosition:l.currPosition]
 }
 
-func (l *Lexer) readNumber() string {
+// readNumber reads an integer or a float such as `3.14` or `1e-3`. Integers may carry
+// a base prefix (`0x`, `0o`, `0b`) and digits may be separated by `_`; validating
+// the digits is left to the parser so malformed literals are reported as one token.
+func (l *Lexer) readNumber() (string, token.TokenType) {
 	startingPosition := l.currPosition
-	for unicode.IsDigit(rune(l.currChar)) {
+	var tokenType token.TokenType = token.INT
+
+	if l.currChar == '0' && isBasePrefix(l.peekChar()) {
+		l.readChar()
+		l.readChar()
+		for isLetter(l.currChar) || isDigit(l.currChar) {
+			l.readChar()
+		}
+		return l.input[startingPosition:l.currPosition], tokenType
+	}
+
+	l.readDigits()
+
+	if l.currChar == '.' && isDigit(l.peekChar()) {
+		tokenType = token.FLOAT
+		l.readChar()
+		l.readDigits()
+	}
+
+	if l.currChar == 'e' || l.currChar == 'E' {
+		peeked := l.peekChar()
+		if isDigit(peeked) || ((peeked == '+' || peeked == '-') && isDigit(l.peekCharAt(1))) {
+			tokenType = token.FLOAT
+			l.readChar()
+			if l.currChar == '+' || l.currChar == '-' {
+				l.readChar()
+			}
+			l.readDigits()
+		}
+	}
+
+	return l.input[startingPosition:l.currPosition], tokenType
+}
+
+func (l *Lexer) readDigits() {
+	for isDigit(l.currChar) || l.currChar == '_' {
 		l.readChar()
 	}
-	return l.input[startingPosition:l.currPosition]
 }
 
 func (l *Lexer) eatWhitespace() {
@@ -151,15 +332,52 @@ func (l *Lexer) eatWhitespace() {
 	}
 }
 
-func (l *Lexer) readString(deli byte) string {
+// readComment reads a `//` comment up to the end of the line or a `/* */` comment,
+// which may be nested. It reports false for a block comment that never ends.
+func (l *Lexer) readComment() (string, bool) {
+	startingPosition := l.currPosition
+
+	if l.peekChar() == '/' {
+		for l.currChar != '\n' && l.currChar != 0 {
+			l.readChar()
+		}
+		return l.input[startingPosition:l.currPosition], true
+	}
+
+	l.readChar() // /
+	l.readChar() // *
+	depth := 1
+	for depth > 0 {
+		switch {
+		case l.currChar == 0:
+			return l.input[startingPosition:l.currPosition], false
+		case l.currChar == '/' && l.peekChar() == '*':
+			depth++
+			l.readChar()
+		case l.currChar == '*' && l.peekChar() == '/':
+			depth--
+			l.readChar()
+		}
+		l.readChar()
+	}
+	return l.input[startingPosition:l.currPosition], true
+}
+
+// readString reads the string up to the closing deli, it's unterminated when
+// the input ends first.
+func (l *Lexer) readString(deli rune) (string, bool) {
 	out := ""
 	for {
 		l.readChar()
-		if l.currChar == deli || l.currChar == 0 {
-			break
+		if l.currChar == 0 {
+			return out, false
+		}
+		if l.currChar == deli {
+			return out, true
 		}
 
-		if l.currChar == '\\' {
+		ch := l.currChar
+		if ch == '\\' {
 			if l.peekChar() == '\n' {
 				l.readChar()
 				continue
@@ -169,21 +387,36 @@ func (l *Lexer) readString(deli byte) string {
 
 			switch l.currChar {
 			case 'n':
-				l.currChar = '\n'
+				ch = '\n'
 			case 'r':
-				l.currChar = '\r'
+				ch = '\r'
 			case 't':
-				l.currChar = '\t'
-			case '"':
-				l.currChar = '"'
-			case '\\':
-				l.currChar = '\\'
+				ch = '\t'
 			case 0:
-				break
+				return out, false
+			default:
+				// covers \" \` and \\
+				ch = l.currChar
 			}
 		}
 
-		out = out + string(l.currChar)
+		out = out + string(ch)
 	}
-	return out
+}
+
+func isLetter(ch rune) bool {
+	return unicode.IsLetter(ch) || ch == '_'
+}
+
+func isBasePrefix(ch rune) bool {
+	switch ch {
+	case 'x', 'X', 'o', 'O', 'b', 'B':
+		return true
+	default:
+		return false
+	}
+}
+
+func isDigit(ch rune) bool {
+	return '0' <= ch && ch <= '9'
 }
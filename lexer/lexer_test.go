@@ -14,7 +14,7 @@ var add = fun(x, y) {
 };
 
 var result = add(five, ten);
-!-/*5;
+!-/ *5;
 5 < 10 > 5;
 
 if (5 < 10) {
@@ -131,3 +131,414 @@ if (5 < 10) {
 		}
 	}
 }
+
+func TestNextTokenUnicode(t *testing.T) {
+	input := `var größe = "héllo 👋";
+var 名前 = größe;
+var snake_case1 = 1;`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.VAR, "var"},
+		{token.IDENTIFIER, "größe"},
+		{token.ASSIGN, "="},
+		{token.STRING, "héllo 👋"},
+		{token.SEMICOLON, ";"},
+		{token.VAR, "var"},
+		{token.IDENTIFIER, "名前"},
+		{token.ASSIGN, "="},
+		{token.IDENTIFIER, "größe"},
+		{token.SEMICOLON, ";"},
+		{token.VAR, "var"},
+		{token.IDENTIFIER, "snake_case1"},
+		{token.ASSIGN, "="},
+		{token.INT, "1"},
+		{token.SEMICOLON, ";"},
+		{token.EOF, ""},
+	}
+
+	lexer := New(input)
+
+	for i, tt := range tests {
+		tok := lexer.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tok.Type wrong. expected=%q, got=%q, token=%v", i, tt.expectedType, tok.Type, tok)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - tok.Literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestNextTokenPositions(t *testing.T) {
+	input := "var a = 1;\nvar größe = \"é\";\n  a"
+
+	tests := []struct {
+		expectedLiteral string
+		expectedLine    int
+		expectedColumn  int
+		expectedOffset  int
+	}{
+		{"var", 1, 1, 0},
+		{"a", 1, 5, 4},
+		{"=", 1, 7, 6},
+		{"1", 1, 9, 8},
+		{";", 1, 10, 9},
+		{"var", 2, 1, 11},
+		{"größe", 2, 5, 15},
+		{"=", 2, 11, 23},
+		{"é", 2, 13, 25},
+		{";", 2, 16, 29},
+		{"a", 3, 3, 33},
+	}
+
+	lexer := NewFile("test.itop", input)
+
+	for i, tt := range tests {
+		tok := lexer.NextToken()
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - tok.Literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+
+		if tok.Pos.File != "test.itop" {
+			t.Fatalf("tests[%d] - tok.Pos.File wrong. expected=%q, got=%q", i, "test.itop", tok.Pos.File)
+		}
+
+		if tok.Pos.Line != tt.expectedLine || tok.Pos.Column != tt.expectedColumn || tok.Pos.Offset != tt.expectedOffset {
+			t.Fatalf("tests[%d] - tok.Pos wrong. expected=%d:%d@%d, got=%d:%d@%d", i,
+				tt.expectedLine, tt.expectedColumn, tt.expectedOffset,
+				tok.Pos.Line, tok.Pos.Column, tok.Pos.Offset)
+		}
+	}
+}
+
+func TestNextTokenComments(t *testing.T) {
+	input := `// leading comment
+var a = 10 / 2; // trailing
+/* block
+   /* nested */ still comment */
+a /**/ * 2
+/* never ends`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.COMMENT, "// leading comment"},
+		{token.VAR, "var"},
+		{token.IDENTIFIER, "a"},
+		{token.ASSIGN, "="},
+		{token.INT, "10"},
+		{token.SLASH, "/"},
+		{token.INT, "2"},
+		{token.SEMICOLON, ";"},
+		{token.COMMENT, "// trailing"},
+		{token.COMMENT, "/* block\n   /* nested */ still comment */"},
+		{token.IDENTIFIER, "a"},
+		{token.COMMENT, "/**/"},
+		{token.ASTERISK, "*"},
+		{token.INT, "2"},
+		{token.ILLEGAL, "/* never ends"},
+		{token.EOF, ""},
+	}
+
+	keeping := New(input).KeepComments()
+	skipping := New(input)
+
+	for i, tt := range tests {
+		tok := keeping.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tok.Type wrong. expected=%q, got=%q, token=%v", i, tt.expectedType, tok.Type, tok)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - tok.Literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+
+		if tt.expectedType == token.COMMENT {
+			continue
+		}
+
+		tok = skipping.NextToken()
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - skipping lexer wrong. expected=%q(%q), got=%q(%q)", i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+	}
+}
+
+func TestNextTokenNumbers(t *testing.T) {
+	input := `3.14 10 0.5 1e3 2.5E-2 7e 1. 0x1F 0o17 0b1010 1_000_000 0xZZ 1_000.5`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.FLOAT, "3.14"},
+		{token.INT, "10"},
+		{token.FLOAT, "0.5"},
+		{token.FLOAT, "1e3"},
+		{token.FLOAT, "2.5E-2"},
+		{token.INT, "7"},
+		{token.IDENTIFIER, "e"},
+		{token.INT, "1"},
+		{token.ILLEGAL, "."},
+		{token.INT, "0x1F"},
+		{token.INT, "0o17"},
+		{token.INT, "0b1010"},
+		{token.INT, "1_000_000"},
+		{token.INT, "0xZZ"},
+		{token.FLOAT, "1_000.5"},
+		{token.EOF, ""},
+	}
+
+	lexer := New(input)
+
+	for i, tt := range tests {
+		tok := lexer.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tok.Type wrong. expected=%q, got=%q, token=%v", i, tt.expectedType, tok.Type, tok)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - tok.Literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestNextTokenLoopKeywords(t *testing.T) {
+	input := `while for in break continue`
+
+	tests := []token.TokenType{token.WHILE, token.FOR, token.IN, token.BREAK, token.CONTINUE, token.EOF}
+
+	lexer := New(input)
+
+	for i, expectedType := range tests {
+		tok := lexer.NextToken()
+
+		if tok.Type != expectedType {
+			t.Fatalf("tests[%d] - tok.Type wrong. expected=%q, got=%q, token=%v", i, expectedType, tok.Type, tok)
+		}
+	}
+}
+
+func TestNextTokenExceptionKeywords(t *testing.T) {
+	input := `throw try catch finally`
+
+	tests := []token.TokenType{token.THROW, token.TRY, token.CATCH, token.FINALLY, token.EOF}
+
+	lexer := New(input)
+
+	for i, expectedType := range tests {
+		tok := lexer.NextToken()
+
+		if tok.Type != expectedType {
+			t.Fatalf("tests[%d] - tok.Type wrong. expected=%q, got=%q, token=%v", i, expectedType, tok.Type, tok)
+		}
+	}
+}
+
+func TestNextTokenAssignOperators(t *testing.T) {
+	input := `x = 1; x += 2; x -= 3; x *= 4; x /= 5; x %= 6;`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.IDENTIFIER, "x"},
+		{token.ASSIGN, "="},
+		{token.INT, "1"},
+		{token.SEMICOLON, ";"},
+		{token.IDENTIFIER, "x"},
+		{token.PLUS_ASSIGN, "+="},
+		{token.INT, "2"},
+		{token.SEMICOLON, ";"},
+		{token.IDENTIFIER, "x"},
+		{token.MINUS_ASSIGN, "-="},
+		{token.INT, "3"},
+		{token.SEMICOLON, ";"},
+		{token.IDENTIFIER, "x"},
+		{token.ASTERISK_ASSIGN, "*="},
+		{token.INT, "4"},
+		{token.SEMICOLON, ";"},
+		{token.IDENTIFIER, "x"},
+		{token.SLASH_ASSIGN, "/="},
+		{token.INT, "5"},
+		{token.SEMICOLON, ";"},
+		{token.IDENTIFIER, "x"},
+		{token.PERCENT_ASSIGN, "%="},
+		{token.INT, "6"},
+		{token.SEMICOLON, ";"},
+		{token.EOF, ""},
+	}
+
+	lexer := New(input)
+
+	for i, tt := range tests {
+		tok := lexer.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tok.Type wrong. expected=%q, got=%q, token=%v", i, tt.expectedType, tok.Type, tok)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - tok.Literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestNextTokenLogicalOperators(t *testing.T) {
+	input := `a && b || c & d`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.IDENTIFIER, "a"},
+		{token.AND, "&&"},
+		{token.IDENTIFIER, "b"},
+		{token.OR, "||"},
+		{token.IDENTIFIER, "c"},
+		{token.BIT_AND, "&"},
+		{token.IDENTIFIER, "d"},
+		{token.EOF, ""},
+	}
+
+	lexer := New(input)
+
+	for i, tt := range tests {
+		tok := lexer.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tok.Type wrong. expected=%q, got=%q, token=%v", i, tt.expectedType, tok.Type, tok)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - tok.Literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestNextTokenArithmeticAndBitwiseOperators(t *testing.T) {
+	input := `a % b ** c & d | e ^ f << g >> h ~i <<= >>=`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.IDENTIFIER, "a"},
+		{token.PERCENT, "%"},
+		{token.IDENTIFIER, "b"},
+		{token.POWER, "**"},
+		{token.IDENTIFIER, "c"},
+		{token.BIT_AND, "&"},
+		{token.IDENTIFIER, "d"},
+		{token.BIT_OR, "|"},
+		{token.IDENTIFIER, "e"},
+		{token.BIT_XOR, "^"},
+		{token.IDENTIFIER, "f"},
+		{token.SHIFT_LEFT, "<<"},
+		{token.IDENTIFIER, "g"},
+		{token.SHIFT_RIGHT, ">>"},
+		{token.IDENTIFIER, "h"},
+		{token.TILDE, "~"},
+		{token.IDENTIFIER, "i"},
+		{token.SHIFT_LEFT, "<<"},
+		{token.ASSIGN, "="},
+		{token.SHIFT_RIGHT, ">>"},
+		{token.ASSIGN, "="},
+		{token.EOF, ""},
+	}
+
+	lexer := New(input)
+
+	for i, tt := range tests {
+		tok := lexer.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tok.Type wrong. expected=%q, got=%q, token=%v", i, tt.expectedType, tok.Type, tok)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - tok.Literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestNextTokenEllipsis(t *testing.T) {
+	input := `fun(...rest) { f(...rest) } ..`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.FUNCTION, "fun"},
+		{token.LEFT_PAREN, "("},
+		{token.ELLIPSIS, "..."},
+		{token.IDENTIFIER, "rest"},
+		{token.RIGHT_PAREN, ")"},
+		{token.LEFT_BRACE, "{"},
+		{token.IDENTIFIER, "f"},
+		{token.LEFT_PAREN, "("},
+		{token.ELLIPSIS, "..."},
+		{token.IDENTIFIER, "rest"},
+		{token.RIGHT_PAREN, ")"},
+		{token.RIGHT_BRACE, "}"},
+		{token.ILLEGAL, "."},
+		{token.ILLEGAL, "."},
+		{token.EOF, ""},
+	}
+
+	lexer := New(input)
+
+	for i, tt := range tests {
+		tok := lexer.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tok.Type wrong. expected=%q, got=%q, token=%v", i, tt.expectedType, tok.Type, tok)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - tok.Literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestUnterminated(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{`"closed" + 1`, false},
+		{`"open`, true},
+		{"`raw\nstring", true},
+		{`"escaped \"`, true},
+		{`"ends in a backslash \`, true},
+		{"/* closed */ 1", false},
+		{"/* open /* nested */", true},
+		{"// line comment", false},
+		{"fun() {", false},
+	}
+
+	for _, tt := range tests {
+		l := New(tt.input)
+		var last token.Token
+		for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+			last = tok
+		}
+
+		if l.Unterminated() != tt.expected {
+			t.Errorf("%q: Unterminated() wrong. expected=%t, got=%t", tt.input, tt.expected, l.Unterminated())
+		}
+		// what is left open can't be a token of its own
+		if tt.expected && last.Type != token.ILLEGAL {
+			t.Errorf("%q: last token wrong. expected=%q, got=%q", tt.input, token.ILLEGAL, last.Type)
+		}
+	}
+}
@@ -1,12 +1,10 @@
 package main
 
 import (
-	"fmt"
 	"go-interpreter/itop"
 	"os"
 )
 
 func main() {
-	fmt.Printf("Welcome to itop!\n")
-	itop.Start(os.Stdin, os.Stdout)
+	os.Exit(itop.Main(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
 }
@@ -4,6 +4,10 @@ import (
 	"bytes"
 	"fmt"
 	"go-interpreter/ast"
+	"go-interpreter/code"
+	"go-interpreter/token"
+	"hash/fnv"
+	"strconv"
 	"strings"
 )
 
@@ -12,14 +16,21 @@ type BuiltinFunction func(args ...Object) Object
 
 const (
 	INTEGER_OBJECT      ObjectType = "Integer"
+	FLOAT_OBJECT        ObjectType = "Float"
 	BOOLEAN_OBJECT      ObjectType = "Boolean"
 	ERROR_OBJECT        ObjectType = "Error"
 	NULL_OBJECT         ObjectType = "Null"
 	RETURN_VALUE_OBJECT ObjectType = "ReturnValue"
+	BREAK_OBJECT        ObjectType = "Break"
+	CONTINUE_OBJECT     ObjectType = "Continue"
+	TAIL_CALL_OBJECT    ObjectType = "TailCall"
 	FUNCTION_OBJECT     ObjectType = "Function"
 	STRING_OBJECT       ObjectType = "String"
 	BUILTIN_OBJECT      ObjectType = "BuiltIn"
 	ARRAY_OBJECT        ObjectType = "Array"
+	HASH_OBJECT         ObjectType = "Hash"
+
+	COMPILED_FUNCTION_OBJECT ObjectType = "CompiledFunction"
 )
 
 type Object interface {
@@ -31,6 +42,10 @@ type Integer struct {
 	Value int64
 }
 
+func (i *Integer) HashKey() HashKey {
+	return HashKey{Type: i.Type(), Value: uint64(i.Value)}
+}
+
 func (i *Integer) Inspect() string {
 	return fmt.Sprintf("%d", i.Value)
 }
@@ -39,10 +54,35 @@ func (i *Integer) Type() ObjectType {
 	return INTEGER_OBJECT
 }
 
+type Float struct {
+	Value float64
+}
+
+func (f *Float) Inspect() string {
+	out := strconv.FormatFloat(f.Value, 'g', -1, 64)
+	// keep whole floats distinguishable from integers
+	if !strings.ContainsAny(out, ".eIN") {
+		out += ".0"
+	}
+	return out
+}
+
+func (f *Float) Type() ObjectType {
+	return FLOAT_OBJECT
+}
+
 type Boolean struct {
 	Value bool
 }
 
+func (b *Boolean) HashKey() HashKey {
+	var value uint64
+	if b.Value {
+		value = 1
+	}
+	return HashKey{Type: b.Type(), Value: value}
+}
+
 func (b *Boolean) Inspect() string {
 	return fmt.Sprintf("%t", b.Value)
 }
@@ -51,11 +91,26 @@ func (b *Boolean) Type() ObjectType {
 	return BOOLEAN_OBJECT
 }
 
+// error kinds, reported to catch blocks as the error's "type"
+const (
+	RUNTIME_ERROR = "RuntimeError"
+	THROWN_ERROR  = "Error"
+	// LIMIT_ERROR stops an evaluation that ran out of budget, it can't be caught
+	LIMIT_ERROR = "LimitError"
+)
+
 type Error struct {
+	Kind    string
 	Message string
+	Pos     token.Position
+	// Stack lists the calls the error unwound through, innermost first
+	Stack []Frame
 }
 
 func (e *Error) Inspect() string {
+	if e.Pos.IsValid() {
+		return "Error at " + e.Pos.String() + ": " + e.Message
+	}
 	return "Error: " + e.Message
 }
 
@@ -63,6 +118,42 @@ func (e *Error) Type() ObjectType {
 	return ERROR_OBJECT
 }
 
+// Error lets an error object be handed to Go code as an error.
+func (e *Error) Error() string {
+	return e.Inspect()
+}
+
+// StackTrace renders Stack one call per line, innermost first.
+func (e *Error) StackTrace() string {
+	var out bytes.Buffer
+
+	for i, frame := range e.Stack {
+		if i > 0 {
+			out.WriteString("\n")
+		}
+		out.WriteString("\tin " + frame.String())
+	}
+
+	return out.String()
+}
+
+// Frame is a call to a user-defined function that an error unwound through.
+type Frame struct {
+	Function string
+	CallSite token.Position
+}
+
+func (f Frame) String() string {
+	return f.Description() + " called at " + f.CallSite.String()
+}
+
+func (f Frame) Description() string {
+	if f.Function == "" {
+		return "anonymous function"
+	}
+	return "`" + f.Function + "`"
+}
+
 type Null struct{}
 
 func (n *Null) Inspect() string {
@@ -85,22 +176,84 @@ func (rv *ReturnValue) Type() ObjectType {
 	return RETURN_VALUE_OBJECT
 }
 
+// Break and Continue are the signals that `break` and `continue` send to the enclosing loop.
+type Break struct{}
+
+func (b *Break) Inspect() string {
+	return "break"
+}
+
+func (b *Break) Type() ObjectType {
+	return BREAK_OBJECT
+}
+
+type Continue struct{}
+
+func (c *Continue) Inspect() string {
+	return "continue"
+}
+
+func (c *Continue) Type() ObjectType {
+	return CONTINUE_OBJECT
+}
+
+// TailCall is a call made by `return f(...)`, returned unmade so the caller's
+// call can be replaced by it.
+type TailCall struct {
+	Function Object
+	Args     []Object
+	Name     string
+	CallSite token.Position
+}
+
+func (tc *TailCall) Inspect() string {
+	return "tail call"
+}
+
+func (tc *TailCall) Type() ObjectType {
+	return TAIL_CALL_OBJECT
+}
+
+// Environment holds variables by name, and by slot for the ones the resolver
+// placed, see ast.Identifier.
 type Environment struct {
 	store map[string]Object
+	slots []Object
 	outer *Environment
+	// Meter accounts for the evaluation running in the environment, nil when it is unlimited
+	Meter Meter
+}
+
+// Meter accounts for the work of an evaluation. Its methods return an error
+// once a limit is hit.
+type Meter interface {
+	// Step is called for every node evaluated
+	Step() *Error
+	// Enter and Leave surround function calls, Leave is only called if Enter succeeded
+	Enter() *Error
+	Leave()
+	// Allocate is called with every new object
+	Allocate(obj Object) *Error
 }
 
 func NewEnvironment() *Environment {
 	store := make(map[string]Object)
-	return &Environment{store, nil}
+	return &Environment{store: store}
 }
 
 func NewInnerEnvironment(outer *Environment) *Environment {
 	env := NewEnvironment()
 	env.outer = outer
+	env.Meter = outer.Meter
 	return env
 }
 
+// NewSlotEnvironment makes an environment with size slots, its names are only
+// allocated once something is set by name.
+func NewSlotEnvironment(outer *Environment, size int) *Environment {
+	return &Environment{slots: make([]Object, size), outer: outer, Meter: outer.Meter}
+}
+
 func (env *Environment) Get(name string) (Object, bool) {
 	obj, ok := env.store[name]
 	if !ok && env.outer != nil {
@@ -110,14 +263,64 @@ func (env *Environment) Get(name string) (Object, bool) {
 }
 
 func (env *Environment) Set(name string, value Object) Object {
+	if env.store == nil {
+		env.store = make(map[string]Object)
+	}
 	env.store[name] = value
 	return value
 }
 
+// GetAt returns the variable in slot of the environment depth levels out, nil if it wasn't set yet.
+func (env *Environment) GetAt(depth int, slot int) Object {
+	for ; depth > 0; depth-- {
+		env = env.outer
+	}
+	return env.slots[slot]
+}
+
+func (env *Environment) SetAt(depth int, slot int, value Object) {
+	for ; depth > 0; depth-- {
+		env = env.outer
+	}
+	env.slots[slot] = value
+}
+
+// Assign updates name in the closest scope that declares it and reports
+// whether such a scope exists.
+func (env *Environment) Assign(name string, value Object) bool {
+	for e := env; e != nil; e = e.outer {
+		if _, ok := e.store[name]; ok {
+			e.store[name] = value
+			return true
+		}
+	}
+	return false
+}
+
 type Function struct {
+	Name       string
 	Parameters []*ast.Identifier
+	Defaults   []ast.Expression
+	Rest       *ast.Identifier
 	Body       *ast.BlockStatement
 	Env        *Environment
+	// Slots is the size of the environment a call needs, see ast.FunctionLiteral
+	Slots int
+}
+
+// Arity returns how many arguments the function accepts; max is -1 for variadic functions.
+func (f *Function) Arity() (min int, max int) {
+	for i := range f.Parameters {
+		if i < len(f.Defaults) && f.Defaults[i] != nil {
+			break
+		}
+		min++
+	}
+
+	if f.Rest != nil {
+		return min, -1
+	}
+	return min, len(f.Parameters)
 }
 
 func (f *Function) Type() ObjectType {
@@ -126,13 +329,10 @@ func (f *Function) Type() ObjectType {
 func (f *Function) Inspect() string {
 	var out bytes.Buffer
 
-	params := make([]string, len(f.Parameters))
-	for _, p := range f.Parameters {
-		params = append(params, p.String())
-	}
-
-	out.WriteString("fun (")
-	out.WriteString(strings.Join(params, ", "))
+	out.WriteString("fun ")
+	out.WriteString(f.Name)
+	out.WriteString("(")
+	out.WriteString(ast.ParameterList(f.Parameters, f.Defaults, f.Rest))
 	out.WriteString(") {\n")
 	out.WriteString(f.Body.String())
 	out.WriteString("\n}")
@@ -140,10 +340,77 @@ func (f *Function) Inspect() string {
 	return out.String()
 }
 
+// CompiledFunction is a function body compiled to bytecode, it only becomes
+// callable as a Closure.
+type CompiledFunction struct {
+	Name          string
+	Instructions  code.Instructions
+	NumLocals     int
+	NumParameters int
+	NumDefaults   int
+	Variadic      bool
+	// Constants is the pool of the program the function was compiled with, the
+	// operands of its OpConstant and OpClosure instructions index it
+	Constants []Object
+
+	// LocalNames, Positions and Names are only read to report errors. Names holds
+	// the identifier an instruction refers to when its operands don't say which
+	LocalNames []string
+	Positions  code.PositionTable
+	Names      map[int]string
+
+	// Signature and Body are the source of the literal, for Inspect
+	Signature string
+	Body      string
+}
+
+// Arity returns how many arguments the function accepts; max is -1 for variadic functions.
+func (cf *CompiledFunction) Arity() (min int, max int) {
+	min = cf.NumParameters - cf.NumDefaults
+	if cf.Variadic {
+		return min, -1
+	}
+	return min, cf.NumParameters
+}
+
+func (cf *CompiledFunction) Type() ObjectType {
+	return COMPILED_FUNCTION_OBJECT
+}
+
+func (cf *CompiledFunction) Inspect() string {
+	return "fun " + cf.Name + "(" + cf.Signature + ") {\n" + cf.Body + "\n}"
+}
+
+// Closure is a CompiledFunction together with the scope it was created in.
+type Closure struct {
+	Fn  *CompiledFunction
+	Env *Scope
+}
+
+func (c *Closure) Type() ObjectType {
+	return FUNCTION_OBJECT
+}
+
+func (c *Closure) Inspect() string {
+	return c.Fn.Inspect()
+}
+
+// Scope holds the variables of one call to a compiled function, indexed by slot.
+type Scope struct {
+	Slots []Object
+	Outer *Scope
+}
+
 type String struct {
 	Value string
 }
 
+func (s *String) HashKey() HashKey {
+	h := fnv.New64a()
+	h.Write([]byte(s.Value))
+	return HashKey{Type: s.Type(), Value: h.Sum64()}
+}
+
 func (s *String) Type() ObjectType {
 	return STRING_OBJECT
 }
@@ -186,3 +453,76 @@ func (a Array) Inspect() string {
 
 	return out.String()
 }
+
+type HashKey struct {
+	Type  ObjectType
+	Value uint64
+}
+
+// Hashable is implemented by objects that can be used as Hash keys.
+type Hashable interface {
+	Object
+	HashKey() HashKey
+}
+
+type HashPair struct {
+	Key   Object
+	Value Object
+}
+
+// Hash remembers insertion order so Inspect and iteration are deterministic.
+type Hash struct {
+	Pairs map[HashKey]HashPair
+	Keys  []HashKey
+	// Caught is the error a catch block got this hash for, so that throwing
+	// the hash again keeps where the error happened
+	Caught *Error
+}
+
+func NewHash() *Hash {
+	return &Hash{Pairs: make(map[HashKey]HashPair)}
+}
+
+func (h *Hash) Type() ObjectType {
+	return HASH_OBJECT
+}
+
+func (h *Hash) Inspect() string {
+	var out bytes.Buffer
+
+	pairs := make([]string, 0, len(h.Keys))
+	for _, pair := range h.Ordered() {
+		pairs = append(pairs, pair.Key.Inspect()+": "+pair.Value.Inspect())
+	}
+
+	out.WriteString("{")
+	out.WriteString(strings.Join(pairs, ", "))
+	out.WriteString("}")
+
+	return out.String()
+}
+
+func (h *Hash) Get(key Hashable) (Object, bool) {
+	pair, ok := h.Pairs[key.HashKey()]
+	if !ok {
+		return nil, false
+	}
+	return pair.Value, true
+}
+
+func (h *Hash) Set(key Hashable, value Object) {
+	hashKey := key.HashKey()
+	if _, ok := h.Pairs[hashKey]; !ok {
+		h.Keys = append(h.Keys, hashKey)
+	}
+	h.Pairs[hashKey] = HashPair{Key: key, Value: value}
+}
+
+// Ordered returns the pairs in insertion order.
+func (h *Hash) Ordered() []HashPair {
+	pairs := make([]HashPair, 0, len(h.Keys))
+	for _, key := range h.Keys {
+		pairs = append(pairs, h.Pairs[key])
+	}
+	return pairs
+}
@@ -1,38 +1,63 @@
 package parser
 
 import (
+	"errors"
 	"fmt"
 	"go-interpreter/ast"
 	"go-interpreter/lexer"
 	"go-interpreter/token"
 	"strconv"
+	"strings"
 )
 
 const (
 	_ int = iota
 	LOWEST
+	ASSIGN       // x = y
+	OR           // ||
+	AND          // &&
 	EQUALS       // ==
 	LESSGREATHER // < >
+	BIT_OR       // |
+	BIT_XOR      // ^
+	BIT_AND      // &
+	SHIFT        // << >>
 	SUM          // +
-	PRODUCT      // *
-	PREFIX       // -X !X
+	PRODUCT      // * / %
+	PREFIX       // -X !X ~X
+	POWER        // **
 	CALL         // fun(X)
 	INDEX        // arr[index]
 )
 
 var precedences = map[token.TokenType]int{
-	token.EQUALS:         EQUALS,
-	token.NOT_EQUALS:     EQUALS,
-	token.LESS_THAN:      LESSGREATHER,
-	token.LESS_EQUALS:    LESSGREATHER,
-	token.GREATER_THAN:   LESSGREATHER,
-	token.GREATER_EQUALS: LESSGREATHER,
-	token.PLUS:           SUM,
-	token.MINUS:          SUM,
-	token.SLASH:          PRODUCT,
-	token.ASTERISK:       PRODUCT,
-	token.LEFT_PAREN:     CALL,
-	token.LEFT_BRACKET:   INDEX,
+	token.ASSIGN:          ASSIGN,
+	token.PLUS_ASSIGN:     ASSIGN,
+	token.MINUS_ASSIGN:    ASSIGN,
+	token.ASTERISK_ASSIGN: ASSIGN,
+	token.SLASH_ASSIGN:    ASSIGN,
+	token.PERCENT_ASSIGN:  ASSIGN,
+	token.OR:              OR,
+	token.AND:             AND,
+	token.EQUALS:          EQUALS,
+	token.NOT_EQUALS:      EQUALS,
+	token.LESS_THAN:       LESSGREATHER,
+	token.LESS_EQUALS:     LESSGREATHER,
+	token.GREATER_THAN:    LESSGREATHER,
+	token.GREATER_EQUALS:  LESSGREATHER,
+	token.PLUS:            SUM,
+	token.MINUS:           SUM,
+	token.BIT_OR:          BIT_OR,
+	token.BIT_XOR:         BIT_XOR,
+	token.BIT_AND:         BIT_AND,
+	token.SHIFT_LEFT:      SHIFT,
+	token.SHIFT_RIGHT:     SHIFT,
+	token.SLASH:           PRODUCT,
+	token.ASTERISK:        PRODUCT,
+	token.PERCENT:         PRODUCT,
+	token.POWER:           POWER,
+	token.LEFT_PAREN:      CALL,
+	token.LEFT_BRACKET:    INDEX,
 }
 
 type (
@@ -40,9 +65,28 @@ type (
 	infixParseFunc  func(ast.Expression) ast.Expression
 )
 
+// ParseError describes a single syntax error. Expected is empty when the parser
+// was not waiting for a specific token.
+type ParseError struct {
+	Pos      token.Position
+	Expected token.TokenType
+	Actual   token.Token
+	Message  string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Pos, e.Message)
+}
+
 type Parser struct {
 	lxr    *lexer.Lexer
-	errors []string
+	errors []*ParseError
+	// panicking suppresses follow-up errors until the parser resynchronizes
+	panicking bool
+	// braceDepth counts the `{` opened up to and including currentToken
+	braceDepth int
+	// loopDepth counts the loops enclosing the current statement within the current function
+	loopDepth int
 
 	currentToken token.Token
 	peekToken    token.Token
@@ -52,13 +96,15 @@ type Parser struct {
 }
 
 func New(lxr *lexer.Lexer) *Parser {
-	p := &Parser{lxr: lxr, errors: []string{}}
+	p := &Parser{lxr: lxr, errors: []*ParseError{}}
 
 	p.prefixParseFuncs = make(map[token.TokenType]prefixParseFunc)
 	p.addPrefixFunc(token.IDENTIFIER, p.parseIdentifier)
 	p.addPrefixFunc(token.INT, p.parseIntegerLiteral)
+	p.addPrefixFunc(token.FLOAT, p.parseFloatLiteral)
 	p.addPrefixFunc(token.BANG, p.parsePrefixExpression)
 	p.addPrefixFunc(token.MINUS, p.parsePrefixExpression)
+	p.addPrefixFunc(token.TILDE, p.parsePrefixExpression)
 	p.addPrefixFunc(token.TRUE, p.parseBoolean)
 	p.addPrefixFunc(token.FALSE, p.parseBoolean)
 	p.addPrefixFunc(token.LEFT_PAREN, p.parseGroupedExpression)
@@ -66,18 +112,35 @@ func New(lxr *lexer.Lexer) *Parser {
 	p.addPrefixFunc(token.FUNCTION, p.parseFunctionLiteral)
 	p.addPrefixFunc(token.STRING, p.parseStringLiteral)
 	p.addPrefixFunc(token.LEFT_BRACKET, p.parseArrayLiteral)
+	p.addPrefixFunc(token.LEFT_BRACE, p.parseHashLiteral)
+	p.addPrefixFunc(token.ELLIPSIS, p.parseSpreadExpression)
 
 	p.infixParseFuncs = make(map[token.TokenType]infixParseFunc)
 	p.addInfixFunc(token.PLUS, p.parseInfixExpression)
 	p.addInfixFunc(token.MINUS, p.parseInfixExpression)
 	p.addInfixFunc(token.SLASH, p.parseInfixExpression)
 	p.addInfixFunc(token.ASTERISK, p.parseInfixExpression)
+	p.addInfixFunc(token.PERCENT, p.parseInfixExpression)
+	p.addInfixFunc(token.POWER, p.parseInfixExpression)
+	p.addInfixFunc(token.BIT_AND, p.parseInfixExpression)
+	p.addInfixFunc(token.BIT_OR, p.parseInfixExpression)
+	p.addInfixFunc(token.BIT_XOR, p.parseInfixExpression)
+	p.addInfixFunc(token.SHIFT_LEFT, p.parseInfixExpression)
+	p.addInfixFunc(token.SHIFT_RIGHT, p.parseInfixExpression)
+	p.addInfixFunc(token.AND, p.parseInfixExpression)
+	p.addInfixFunc(token.OR, p.parseInfixExpression)
 	p.addInfixFunc(token.EQUALS, p.parseInfixExpression)
 	p.addInfixFunc(token.NOT_EQUALS, p.parseInfixExpression)
 	p.addInfixFunc(token.LESS_THAN, p.parseInfixExpression)
 	p.addInfixFunc(token.LESS_EQUALS, p.parseInfixExpression)
 	p.addInfixFunc(token.GREATER_THAN, p.parseInfixExpression)
 	p.addInfixFunc(token.GREATER_EQUALS, p.parseInfixExpression)
+	p.addInfixFunc(token.ASSIGN, p.parseAssignExpression)
+	p.addInfixFunc(token.PLUS_ASSIGN, p.parseAssignExpression)
+	p.addInfixFunc(token.MINUS_ASSIGN, p.parseAssignExpression)
+	p.addInfixFunc(token.ASTERISK_ASSIGN, p.parseAssignExpression)
+	p.addInfixFunc(token.SLASH_ASSIGN, p.parseAssignExpression)
+	p.addInfixFunc(token.PERCENT_ASSIGN, p.parseAssignExpression)
 	p.addInfixFunc(token.LEFT_PAREN, p.parseCallExpression)
 	p.addInfixFunc(token.LEFT_BRACKET, p.parseIndexExpression)
 
@@ -90,6 +153,13 @@ func New(lxr *lexer.Lexer) *Parser {
 func (p *Parser) nextToken() {
 	p.currentToken = p.peekToken
 	p.peekToken = p.lxr.NextToken()
+
+	switch p.currentToken.Type {
+	case token.LEFT_BRACE:
+		p.braceDepth++
+	case token.RIGHT_BRACE:
+		p.braceDepth--
+	}
 }
 
 func (p *Parser) currentTokenEquals(expected token.TokenType) bool {
@@ -109,17 +179,29 @@ func (p *Parser) expectPeek(expected token.TokenType) bool {
 	return false
 }
 
-func (p *Parser) Errors() []string {
+func (p *Parser) Errors() []*ParseError {
 	return p.errors
 }
 
+func (p *Parser) addError(expected token.TokenType, actual token.Token, format string, a ...interface{}) {
+	if p.panicking {
+		return
+	}
+	p.panicking = true
+	p.errors = append(p.errors, &ParseError{
+		Pos:      actual.Pos,
+		Expected: expected,
+		Actual:   actual,
+		Message:  fmt.Sprintf(format, a...),
+	})
+}
+
 func (p *Parser) peekError(t token.TokenType) {
-	msg := fmt.Sprintf("Expected next token to be %q, got %q instead", t, p.peekToken.Type)
-	p.errors = append(p.errors, msg)
+	p.addError(t, p.peekToken, "Expected next token to be %q, got %q instead", t, p.peekToken.Type)
 }
 
 func (p *Parser) noPrefixParseFuncError(t token.TokenType) {
-	p.errors = append(p.errors, fmt.Sprintf("no prefix parse function for %s found", t))
+	p.addError("", p.currentToken, "no prefix parse function for %s found", t)
 }
 
 func (p *Parser) addPrefixFunc(tokenType token.TokenType, fun prefixParseFunc) {
@@ -136,25 +218,99 @@ func (p *Parser) ParseProgram() *ast.Program {
 
 	for !p.currentTokenEquals(token.EOF) {
 		statement := p.parseStatement()
-		program.Statements = append(program.Statements, statement)
+		if statement != nil {
+			program.Statements = append(program.Statements, statement)
+		}
 		p.nextToken()
 	}
 
 	return program
 }
 
+// parseStatement returns nil when the statement contained a syntax error, after
+// skipping ahead to the next statement boundary. Broken statements never reach the AST.
+// An error in a nested block was already recovered from there, so when the
+// statement itself parsed to its end nothing is skipped.
 func (p *Parser) parseStatement() ast.Statement {
+	errorsBefore := len(p.errors)
+	depth := p.braceDepth
+	statement := p.parseStatementNode()
+	if len(p.errors) > errorsBefore {
+		if p.panicking {
+			p.synchronize(depth)
+		}
+		return nil
+	}
+	return statement
+}
+
+// synchronize leaves currentToken on the last token of the broken statement,
+// so the caller's nextToken moves to the start of the next one. Braces opened
+// by the statement are skipped as a whole, back to the depth it started at.
+func (p *Parser) synchronize(depth int) {
+	p.panicking = false
+
+	for !p.currentTokenEquals(token.EOF) {
+		if p.braceDepth <= depth {
+			if p.currentTokenEquals(token.SEMICOLON) {
+				return
+			}
+			if p.peekTokenEquals(token.RIGHT_BRACE) || p.peekTokenEquals(token.EOF) || isStatementKeyword(p.peekToken.Type) {
+				return
+			}
+		}
+		p.nextToken()
+	}
+}
+
+func isStatementKeyword(t token.TokenType) bool {
+	switch t {
+	case token.VAR, token.RETURN, token.WHILE, token.FOR, token.BREAK, token.CONTINUE, token.THROW, token.TRY:
+		return true
+	default:
+		return false
+	}
+}
+
+func (p *Parser) parseStatementNode() ast.Statement {
 	switch p.currentToken.Type {
 	case token.VAR:
 		return p.parseVarStatement()
 	case token.RETURN:
 		return p.parseReturnStatement()
+	case token.WHILE:
+		return p.parseWhileStatement()
+	case token.FOR:
+		return p.parseForStatement()
+	case token.BREAK:
+		return p.parseBreakStatement()
+	case token.CONTINUE:
+		return p.parseContinueStatement()
+	case token.THROW:
+		return p.parseThrowStatement()
+	case token.TRY:
+		return p.parseTryStatement()
+	case token.FUNCTION:
+		if p.peekTokenEquals(token.IDENTIFIER) {
+			return p.parseFunctionStatement()
+		}
+		return p.parseExpressionStatement()
 	default:
 		return p.parseExpressionStatement()
 	}
 }
 
 func (p *Parser) parseVarStatement() *ast.VarStatement {
+	statement := p.parseVarBinding()
+	for p.peekTokenEquals(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return statement
+}
+
+// parseVarBinding parses `var name = value` without its trailing semicolon.
+func (p *Parser) parseVarBinding() *ast.VarStatement {
 	statement := &ast.VarStatement{Token: p.currentToken}
 	if !p.expectPeek(token.IDENTIFIER) {
 		return nil
@@ -169,8 +325,8 @@ func (p *Parser) parseVarStatement() *ast.VarStatement {
 	p.nextToken()
 
 	statement.Value = p.parseExpression(LOWEST)
-	for p.peekTokenEquals(token.SEMICOLON) {
-		p.nextToken()
+	if literal, ok := statement.Value.(*ast.FunctionLiteral); ok && literal.Name == "" {
+		literal.Name = statement.Name.Value
 	}
 
 	return statement
@@ -189,6 +345,190 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	return statement
 }
 
+func (p *Parser) parseThrowStatement() ast.Statement {
+	statement := &ast.ThrowStatement{Token: p.currentToken}
+
+	p.nextToken()
+	statement.Value = p.parseExpression(LOWEST)
+
+	for p.peekTokenEquals(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return statement
+}
+
+func (p *Parser) parseTryStatement() ast.Statement {
+	statement := &ast.TryStatement{Token: p.currentToken}
+	if !p.expectPeek(token.LEFT_BRACE) {
+		return nil
+	}
+	statement.Block = p.parseBlockStatement()
+
+	if p.peekTokenEquals(token.CATCH) {
+		p.nextToken()
+		if !p.expectPeek(token.LEFT_PAREN) || !p.expectPeek(token.IDENTIFIER) {
+			return nil
+		}
+		statement.Param = &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
+		if !p.expectPeek(token.RIGHT_PAREN) || !p.expectPeek(token.LEFT_BRACE) {
+			return nil
+		}
+		statement.Catch = p.parseBlockStatement()
+	}
+
+	if p.peekTokenEquals(token.FINALLY) {
+		p.nextToken()
+		if !p.expectPeek(token.LEFT_BRACE) {
+			return nil
+		}
+		statement.Finally = p.parseBlockStatement()
+	}
+
+	if statement.Catch == nil && statement.Finally == nil {
+		p.addError(token.CATCH, p.peekToken, "Expected catch or finally after try block, got %q instead", p.peekToken.Type)
+		return nil
+	}
+
+	for p.peekTokenEquals(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return statement
+}
+
+func (p *Parser) parseWhileStatement() ast.Statement {
+	statement := &ast.WhileStatement{Token: p.currentToken}
+	if !p.expectPeek(token.LEFT_PAREN) {
+		return nil
+	}
+
+	p.nextToken()
+	statement.Condition = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RIGHT_PAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LEFT_BRACE) {
+		return nil
+	}
+
+	statement.Body = p.parseLoopBody()
+	for p.peekTokenEquals(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return statement
+}
+
+func (p *Parser) parseForStatement() ast.Statement {
+	forToken := p.currentToken
+	if !p.expectPeek(token.LEFT_PAREN) {
+		return nil
+	}
+
+	p.nextToken()
+	if p.currentTokenEquals(token.IDENTIFIER) && p.peekTokenEquals(token.IN) {
+		return p.parseForInStatement(forToken)
+	}
+
+	statement := &ast.ForStatement{Token: forToken}
+
+	if !p.currentTokenEquals(token.SEMICOLON) {
+		if p.currentTokenEquals(token.VAR) {
+			statement.Init = p.parseVarBinding()
+		} else {
+			statement.Init = &ast.ExpressionStatement{Token: p.currentToken, Value: p.parseExpression(LOWEST)}
+		}
+
+		if !p.expectPeek(token.SEMICOLON) {
+			return nil
+		}
+	}
+
+	if !p.peekTokenEquals(token.SEMICOLON) {
+		p.nextToken()
+		statement.Condition = p.parseExpression(LOWEST)
+	}
+
+	if !p.expectPeek(token.SEMICOLON) {
+		return nil
+	}
+
+	if !p.peekTokenEquals(token.RIGHT_PAREN) {
+		p.nextToken()
+		statement.Step = p.parseExpression(LOWEST)
+	}
+
+	if !p.expectPeek(token.RIGHT_PAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LEFT_BRACE) {
+		return nil
+	}
+
+	statement.Body = p.parseLoopBody()
+	for p.peekTokenEquals(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return statement
+}
+
+func (p *Parser) parseForInStatement(forToken token.Token) ast.Statement {
+	statement := &ast.ForInStatement{Token: forToken}
+	statement.Variable = &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
+
+	p.nextToken() // in
+	p.nextToken()
+	statement.Iterable = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RIGHT_PAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LEFT_BRACE) {
+		return nil
+	}
+
+	statement.Body = p.parseLoopBody()
+	for p.peekTokenEquals(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return statement
+}
+
+func (p *Parser) parseLoopBody() *ast.BlockStatement {
+	p.loopDepth++
+	defer func() { p.loopDepth-- }()
+	return p.parseBlockStatement()
+}
+
+func (p *Parser) parseBreakStatement() ast.Statement {
+	statement := &ast.BreakStatement{Token: p.currentToken}
+	if p.loopDepth == 0 {
+		p.addError("", p.currentToken, "break outside of loop")
+		return nil
+	}
+
+	if p.peekTokenEquals(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return statement
+}
+
+func (p *Parser) parseContinueStatement() ast.Statement {
+	statement := &ast.ContinueStatement{Token: p.currentToken}
+	if p.loopDepth == 0 {
+		p.addError("", p.currentToken, "continue outside of loop")
+		return nil
+	}
+
+	if p.peekTokenEquals(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return statement
+}
+
 func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 	statement := &ast.ExpressionStatement{Token: p.currentToken}
 	statement.Value = p.parseExpression(LOWEST)
@@ -239,10 +579,19 @@ func (p *Parser) parseIdentifier() ast.Expression {
 func (p *Parser) parseIntegerLiteral() ast.Expression {
 	literal := &ast.IntegerLiteral{Token: p.currentToken}
 
-	value, err := strconv.ParseInt(p.currentToken.Literal, 10, 64)
+	digits, base, name := splitIntegerBase(p.currentToken.Literal)
+	if !validDigits(digits, base) {
+		p.addError("", p.currentToken, "Invalid %s literal %q", name, p.currentToken.Literal)
+		return nil
+	}
+
+	value, err := strconv.ParseInt(strings.ReplaceAll(digits, "_", ""), base, 64)
 	if err != nil {
-		msg := fmt.Sprintf("Could not parse %q as integer", p.currentToken.Literal)
-		p.errors = append(p.errors, msg)
+		if errors.Is(err, strconv.ErrRange) {
+			p.addError("", p.currentToken, "Integer literal %q overflows int64", p.currentToken.Literal)
+		} else {
+			p.addError("", p.currentToken, "Could not parse %q as integer", p.currentToken.Literal)
+		}
 		return nil
 	}
 
@@ -250,6 +599,65 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 	return literal
 }
 
+func (p *Parser) parseFloatLiteral() ast.Expression {
+	literal := &ast.FloatLiteral{Token: p.currentToken}
+
+	mantissa, exponent, _ := strings.Cut(strings.ToLower(p.currentToken.Literal), "e")
+	whole, fraction, _ := strings.Cut(mantissa, ".")
+	exponent = strings.TrimLeft(exponent, "+-")
+	if !validDigits(whole, 10) || (fraction != "" && !validDigits(fraction, 10)) ||
+		(exponent != "" && !validDigits(exponent, 10)) {
+		p.addError("", p.currentToken, "Invalid float literal %q", p.currentToken.Literal)
+		return nil
+	}
+
+	value, err := strconv.ParseFloat(strings.ReplaceAll(p.currentToken.Literal, "_", ""), 64)
+	if err != nil {
+		p.addError("", p.currentToken, "Could not parse %q as float", p.currentToken.Literal)
+		return nil
+	}
+
+	literal.Value = value
+	return literal
+}
+
+func splitIntegerBase(literal string) (digits string, base int, name string) {
+	if len(literal) > 1 && literal[0] == '0' {
+		switch literal[1] {
+		case 'x', 'X':
+			return literal[2:], 16, "hexadecimal"
+		case 'o', 'O':
+			return literal[2:], 8, "octal"
+		case 'b', 'B':
+			return literal[2:], 2, "binary"
+		}
+	}
+	return literal, 10, "decimal"
+}
+
+// validDigits reports whether digits is a non-empty run of digits in the given
+// base where every `_` sits between two digits.
+func validDigits(digits string, base int) bool {
+	if digits == "" {
+		return false
+	}
+
+	for i, ch := range digits {
+		if ch == '_' {
+			if i == 0 || i == len(digits)-1 || digits[i-1] == '_' {
+				return false
+			}
+			continue
+		}
+
+		value, err := strconv.ParseInt(string(ch), 36, 64)
+		if err != nil || int(value) >= base {
+			return false
+		}
+	}
+	return true
+}
+
 func (p *Parser) parsePrefixExpression() ast.Expression {
 	expression := &ast.PrefixExpression{
 		Token:    p.currentToken,
@@ -270,12 +678,36 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	}
 
 	precedence := p.currentPrecedence()
+	if p.currentTokenEquals(token.POWER) {
+		// right-associative: 2 ** 3 ** 2 is 2 ** (3 ** 2)
+		precedence--
+	}
 	p.nextToken()
 	expression.Right = p.parseExpression(precedence)
 
 	return expression
 }
 
+func (p *Parser) parseAssignExpression(left ast.Expression) ast.Expression {
+	name, ok := left.(*ast.Identifier)
+	if !ok {
+		p.addError("", p.currentToken, "cannot assign to %s", left.String())
+		return nil
+	}
+
+	expression := &ast.AssignExpression{
+		Token:    p.currentToken,
+		Name:     name,
+		Operator: p.currentToken.Literal,
+	}
+
+	// one below ASSIGN so `a = b = c` groups as `a = (b = c)`
+	p.nextToken()
+	expression.Value = p.parseExpression(ASSIGN - 1)
+
+	return expression
+}
+
 func (p *Parser) parseBoolean() ast.Expression {
 	return &ast.Boolean{
 		Token: p.currentToken,
@@ -331,51 +763,107 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 
 	for !p.currentTokenEquals(token.RIGHT_BRACE) && !p.currentTokenEquals(token.EOF) {
 		statement := p.parseStatement()
-		block.Statements = append(block.Statements, statement)
+		if statement != nil {
+			block.Statements = append(block.Statements, statement)
+		}
 		p.nextToken()
 	}
 	return block
 }
 
+func (p *Parser) parseFunctionStatement() ast.Statement {
+	statement := &ast.FunctionStatement{Token: p.currentToken}
+
+	p.nextToken()
+	statement.Name = &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
+	statement.Function = &ast.FunctionLiteral{Token: statement.Token, Name: statement.Name.Value}
+
+	if !p.parseFunction(statement.Function) {
+		return nil
+	}
+
+	for p.peekTokenEquals(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return statement
+}
+
 func (p *Parser) parseFunctionLiteral() ast.Expression {
 	literal := &ast.FunctionLiteral{Token: p.currentToken}
+	if !p.parseFunction(literal) {
+		return nil
+	}
+	return literal
+}
 
+// parseFunction parses the parameters and body that follow `fun` or `fun name`.
+func (p *Parser) parseFunction(literal *ast.FunctionLiteral) bool {
 	if !p.expectPeek(token.LEFT_PAREN) {
-		return nil
+		return false
 	}
 
-	literal.Parameters = p.parseFunctionParameters()
+	if !p.parseFunctionParameters(literal) {
+		return false
+	}
 
 	if !p.expectPeek(token.LEFT_BRACE) {
-		return nil
+		return false
 	}
 
+	// loops outside the function body can't be broken out of from inside it
+	loopDepth := p.loopDepth
+	p.loopDepth = 0
 	literal.Body = p.parseBlockStatement()
-	return literal
+	p.loopDepth = loopDepth
+	return true
 }
 
-func (p *Parser) parseFunctionParameters() []*ast.Identifier {
-	var identifiers []*ast.Identifier
+// parseFunctionParameters parses `a, b = 10, ...rest)`. Parameters with a default
+// value come after the ones without, and the rest parameter comes last.
+func (p *Parser) parseFunctionParameters(literal *ast.FunctionLiteral) bool {
+	literal.Parameters = []*ast.Identifier{}
+	literal.Defaults = []ast.Expression{}
 
-	p.nextToken()
-	if p.currentTokenEquals(token.RIGHT_PAREN) {
-		return identifiers
+	if p.peekTokenEquals(token.RIGHT_PAREN) {
+		p.nextToken()
+		return true
 	}
 
-	identifier := &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
-	identifiers = append(identifiers, identifier)
-
-	for p.peekTokenEquals(token.COMMA) {
-		p.nextToken() // comma
+	for {
 		p.nextToken()
+
+		if p.currentTokenEquals(token.ELLIPSIS) {
+			if !p.expectPeek(token.IDENTIFIER) {
+				return false
+			}
+			literal.Rest = &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
+			return p.expectPeek(token.RIGHT_PAREN)
+		}
+
+		if !p.currentTokenEquals(token.IDENTIFIER) {
+			p.addError(token.IDENTIFIER, p.currentToken, "Expected parameter name, got %q instead", p.currentToken.Type)
+			return false
+		}
 		identifier := &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
-		identifiers = append(identifiers, identifier)
-	}
 
-	if !p.expectPeek(token.RIGHT_PAREN) {
-		return nil
+		var defaultValue ast.Expression
+		if p.peekTokenEquals(token.ASSIGN) {
+			p.nextToken()
+			p.nextToken()
+			defaultValue = p.parseExpression(LOWEST)
+		} else if len(literal.Defaults) > 0 && literal.Defaults[len(literal.Defaults)-1] != nil {
+			p.addError(token.ASSIGN, p.currentToken, "parameter %s without default follows parameter with default", identifier.Value)
+			return false
+		}
+
+		literal.Parameters = append(literal.Parameters, identifier)
+		literal.Defaults = append(literal.Defaults, defaultValue)
+
+		if !p.peekTokenEquals(token.COMMA) {
+			return p.expectPeek(token.RIGHT_PAREN)
+		}
+		p.nextToken() // comma
 	}
-	return identifiers
 }
 
 func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
@@ -384,9 +872,18 @@ func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
 	return expression
 }
 
+func (p *Parser) parseSpreadExpression() ast.Expression {
+	expression := &ast.SpreadExpression{Token: p.currentToken}
+
+	p.nextToken()
+	expression.Value = p.parseExpression(LOWEST)
+
+	return expression
+}
+
 func (p *Parser) parseStringLiteral() ast.Expression {
 	return &ast.StringLiteral{
-		Token: token.Token{},
+		Token: p.currentToken,
 		Value: p.currentToken.Literal,
 	}
 }
@@ -397,6 +894,33 @@ func (p *Parser) parseArrayLiteral() ast.Expression {
 	return arr
 }
 
+func (p *Parser) parseHashLiteral() ast.Expression {
+	hash := &ast.HashLiteral{Token: p.currentToken, Pairs: []ast.HashPair{}}
+
+	for !p.peekTokenEquals(token.RIGHT_BRACE) {
+		p.nextToken()
+		key := p.parseExpression(LOWEST)
+
+		if !p.expectPeek(token.COLON) {
+			return nil
+		}
+
+		p.nextToken()
+		value := p.parseExpression(LOWEST)
+		hash.Pairs = append(hash.Pairs, ast.HashPair{Key: key, Value: value})
+
+		if !p.peekTokenEquals(token.RIGHT_BRACE) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.RIGHT_BRACE) {
+		return nil
+	}
+
+	return hash
+}
+
 func (p *Parser) parseExpressionList(till token.TokenType) []ast.Expression {
 	list := []ast.Expression{}
 
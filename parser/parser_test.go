@@ -147,6 +147,99 @@ func TestIntegerStatements(t *testing.T) {
 	}
 }
 
+func TestIntegerLiteralBases(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"0x1F", 31},
+		{"0XfF", 255},
+		{"0o17", 15},
+		{"0b1010", 10},
+		{"1_000_000", 1000000},
+		{"0xFF_FF", 65535},
+		{"017", 17},
+		{"9223372036854775807", 9223372036854775807},
+	}
+
+	for _, tt := range tests {
+		lxr := lexer.New(tt.input)
+		parsr := New(lxr)
+		program := parsr.ParseProgram()
+		checkParserErrors(t, parsr)
+
+		statement := program.Statements[0].(*ast.ExpressionStatement)
+		literal, ok := statement.Value.(*ast.IntegerLiteral)
+		if !ok {
+			t.Fatalf("statement value is not ast.IntegerLiteral, got=%T", statement.Value)
+		}
+
+		if literal.Value != tt.expected {
+			t.Errorf("literal Value for %q is not %d, got=%d", tt.input, tt.expected, literal.Value)
+		}
+	}
+}
+
+func TestMalformedNumberLiterals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"0x1G", "1:1: Invalid hexadecimal literal \"0x1G\""},
+		{"0x", "1:1: Invalid hexadecimal literal \"0x\""},
+		{"0o8", "1:1: Invalid octal literal \"0o8\""},
+		{"0b102", "1:1: Invalid binary literal \"0b102\""},
+		{"1__000", "1:1: Invalid decimal literal \"1__000\""},
+		{"1_", "1:1: Invalid decimal literal \"1_\""},
+		{"1.5_", "1:1: Invalid float literal \"1.5_\""},
+		{"9223372036854775808", "1:1: Integer literal \"9223372036854775808\" overflows int64"},
+		{"0x1_0000_0000_0000_0000", "1:1: Integer literal \"0x1_0000_0000_0000_0000\" overflows int64"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != 1 {
+			t.Fatalf("expected 1 parser error for %q, got=%d", tt.input, len(errors))
+		}
+
+		if errors[0].Error() != tt.expected {
+			t.Errorf("wrong error. want=%q, got=%q", tt.expected, errors[0].Error())
+		}
+	}
+}
+
+func TestFloatStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"3.14;", 3.14},
+		{"0.5", 0.5},
+		{"1e3", 1000},
+	}
+
+	for _, tt := range tests {
+		lxr := lexer.New(tt.input)
+		parsr := New(lxr)
+		program := parsr.ParseProgram()
+		checkParserErrors(t, parsr)
+
+		statement := program.Statements[0].(*ast.ExpressionStatement)
+		literal, ok := statement.Value.(*ast.FloatLiteral)
+		if !ok {
+			t.Fatalf("statement value is not ast.FloatLiteral, got=%T", statement.Value)
+		}
+
+		if literal.Value != tt.expected {
+			t.Errorf("literal Value is not %g, got=%g", tt.expected, literal.Value)
+		}
+	}
+}
+
 func TestBooleanExpression(t *testing.T) {
 	tests := []struct {
 		input           string
@@ -254,6 +347,8 @@ func TestParsingInfixExpressions(t *testing.T) {
 		{"foobar < barfoo;", "foobar", "<", "barfoo"},
 		{"foobar == barfoo;", "foobar", "==", "barfoo"},
 		{"foobar != barfoo;", "foobar", "!=", "barfoo"},
+		{"foobar && barfoo;", "foobar", "&&", "barfoo"},
+		{"foobar || barfoo;", "foobar", "||", "barfoo"},
 		{"true == true", true, "==", true},
 		{"true != false", true, "!=", false},
 		{"false == false", false, "==", false},
@@ -398,6 +493,27 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"add((((a + b) + ((c * d) / f)) + g))",
 		},
 		{"a * [1, 2, 3, 4][b * c] * d", "((a * ([1, 2, 3, 4][(b * c)])) * d)"},
+		{"x = y + 1", "(x = (y + 1))"},
+		{"x = y = z", "(x = (y = z))"},
+		{"x += y * 2", "(x += (y * 2))"},
+		{"x %= 3 == 1", "(x %= (3 == 1))"},
+		{"a || b && c", "(a || (b && c))"},
+		{"a && b || c && d", "((a && b) || (c && d))"},
+		{"a == b && c < d", "((a == b) && (c < d))"},
+		{"x = a || b", "(x = (a || b))"},
+		{"!a && b", "((!a) && b)"},
+		{"a * b % c", "((a * b) % c)"},
+		{"a + b % c", "(a + (b % c))"},
+		{"2 ** 3 ** 2", "(2 ** (3 ** 2))"},
+		{"a * b ** c", "(a * (b ** c))"},
+		{"-a ** b", "(-(a ** b))"},
+		{"a ** -b", "(a ** (-b))"},
+		{"a | b ^ c & d", "(a | (b ^ (c & d)))"},
+		{"a & b << c + d", "(a & (b << (c + d)))"},
+		{"a >> 1 == b", "((a >> 1) == b)"},
+		{"a & b == c", "((a & b) == c)"},
+		{"~a & b", "((~a) & b)"},
+		{"a || b | c", "(a || (b | c))"},
 		{"add(a * b[2], b[1], 2 * [1, 2][1])", "add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))"},
 	}
 
@@ -599,6 +715,138 @@ func TestFunctionParameterParsing(t *testing.T) {
 	}
 }
 
+func TestFunctionDefaultAndRestParameters(t *testing.T) {
+	tests := []struct {
+		input            string
+		expectedParams   []string
+		expectedDefaults []string
+		expectedRest     string
+		expectedString   string
+	}{
+		{"fun(a, b = 10) {}", []string{"a", "b"}, []string{"", "10"}, "", "fun(a, b = 10) "},
+		{"fun(a = 1, b = a * 2) {}", []string{"a", "b"}, []string{"1", "(a * 2)"}, "", "fun(a = 1, b = (a * 2)) "},
+		{"fun(...rest) {}", []string{}, []string{}, "rest", "fun(...rest) "},
+		{"fun(a, b = 10, ...rest) {}", []string{"a", "b"}, []string{"", "10"}, "rest", "fun(a, b = 10, ...rest) "},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		function := program.Statements[0].(*ast.ExpressionStatement).Value.(*ast.FunctionLiteral)
+
+		if len(function.Parameters) != len(tt.expectedParams) {
+			t.Fatalf("length parameters wrong. want %d, got=%d", len(tt.expectedParams), len(function.Parameters))
+		}
+
+		for i, ident := range tt.expectedParams {
+			testLiteralExpression(t, function.Parameters[i], ident)
+
+			actual := ""
+			if function.Defaults[i] != nil {
+				actual = function.Defaults[i].String()
+			}
+			if actual != tt.expectedDefaults[i] {
+				t.Errorf("default of %s wrong. want=%q, got=%q", ident, tt.expectedDefaults[i], actual)
+			}
+		}
+
+		actualRest := ""
+		if function.Rest != nil {
+			actualRest = function.Rest.Value
+		}
+		if actualRest != tt.expectedRest {
+			t.Errorf("rest parameter wrong. want=%q, got=%q", tt.expectedRest, actualRest)
+		}
+
+		if function.String() != tt.expectedString {
+			t.Errorf("function.String() wrong. want=%q, got=%q", tt.expectedString, function.String())
+		}
+	}
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{"fun(a = 1, b) {}", "1:12: parameter b without default follows parameter with default"},
+		{"fun(...rest, a) {}", "1:12: Expected next token to be \")\", got \",\" instead"},
+		{"fun(...) {}", "1:8: Expected next token to be \"IDENTIFIER\", got \")\" instead"},
+	}
+
+	for _, tt := range errorTests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != 1 {
+			t.Fatalf("expected 1 parser error for %q, got=%d (%v)", tt.input, len(errors), errors)
+		}
+
+		if errors[0].Error() != tt.expected {
+			t.Errorf("wrong error. want=%q, got=%q", tt.expected, errors[0].Error())
+		}
+	}
+}
+
+func TestFunctionStatement(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedName   string
+		expectedParams []string
+		expectedString string
+	}{
+		{"fun add(a, b) { a + b }", "add", []string{"a", "b"}, "fun add(a, b) (a + b)"},
+		{"fun noop() {};", "noop", []string{}, "fun noop() "},
+		{"fun f(a, b = 1, ...rest) { rest }", "f", []string{"a", "b"}, "fun f(a, b = 1, ...rest) rest"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statement. got=%d", len(program.Statements))
+		}
+
+		statement, ok := program.Statements[0].(*ast.FunctionStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not ast.FunctionStatement. got=%T", program.Statements[0])
+		}
+
+		if statement.Name.Value != tt.expectedName || statement.Function.Name != tt.expectedName {
+			t.Errorf("function name wrong. want=%q, got=%q (literal %q)", tt.expectedName, statement.Name.Value, statement.Function.Name)
+		}
+
+		if len(statement.Function.Parameters) != len(tt.expectedParams) {
+			t.Fatalf("length parameters wrong. want %d, got=%d", len(tt.expectedParams), len(statement.Function.Parameters))
+		}
+		for i, ident := range tt.expectedParams {
+			testLiteralExpression(t, statement.Function.Parameters[i], ident)
+		}
+
+		if statement.String() != tt.expectedString {
+			t.Errorf("statement.String() wrong. want=%q, got=%q", tt.expectedString, statement.String())
+		}
+	}
+
+	l := lexer.New("var double = fun(x) { x * 2 }; var y = fun named() {};")
+	p := New(l)
+	program := p.ParseProgram()
+	if len(p.Errors()) != 1 {
+		t.Fatalf("expected 1 parser error, got=%d (%v)", len(p.Errors()), p.Errors())
+	}
+
+	literal := program.Statements[0].(*ast.VarStatement).Value.(*ast.FunctionLiteral)
+	if literal.Name != "double" {
+		t.Errorf("function bound by var not named after it. got=%q", literal.Name)
+	}
+}
+
 func TestCallExpressionParsing(t *testing.T) {
 	input := "add(1, 2 * 3, 4 + 5);"
 
@@ -658,6 +906,11 @@ func TestCallExpressionParameterParsing(t *testing.T) {
 			expectedIdent: "add",
 			expectedArgs:  []string{"1", "(2 * 3)", "(4 + 5)"},
 		},
+		{
+			input:         "add(1, ...rest);",
+			expectedIdent: "add",
+			expectedArgs:  []string{"1", "...rest"},
+		},
 	}
 
 	for _, tt := range tests {
@@ -742,6 +995,240 @@ func TestArrayLiterals(t *testing.T) {
 	}
 }
 
+func TestParsingHashLiterals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"{}", "{}"},
+		{`{"one": 1, "two": 2}`, "{one: 1, two: 2}"},
+		{`{1: "x", true: 2}`, "{1: x, true: 2}"},
+		{`{"one": 0 + 1, "two": 10 - 8,}`, "{one: (0 + 1), two: (10 - 8)}"},
+		{`{"a": {"b": 1}}["a"]`, "({a: {b: 1}}[a])"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		statement := program.Statements[0].(*ast.ExpressionStatement)
+		if statement.Value.String() != tt.expected {
+			t.Errorf("wrong hash literal. want=%q, got=%q", tt.expected, statement.Value.String())
+		}
+	}
+
+	l := lexer.New(`{"one": 1, "two": 2}`)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	hash, ok := program.Statements[0].(*ast.ExpressionStatement).Value.(*ast.HashLiteral)
+	if !ok {
+		t.Fatalf("statement is not ast.HashLiteral. got=%T", program.Statements[0].(*ast.ExpressionStatement).Value)
+	}
+
+	if len(hash.Pairs) != 2 {
+		t.Fatalf("hash.Pairs has wrong length. got=%d", len(hash.Pairs))
+	}
+
+	testIntegerLiteral(t, hash.Pairs[0].Value, 1)
+	testIntegerLiteral(t, hash.Pairs[1].Value, 2)
+}
+
+func TestHashLiteralErrorRecovery(t *testing.T) {
+	input := `var h = {"a" 1, "b": 2};
+var x = 1;`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+
+	if len(p.Errors()) != 1 {
+		t.Fatalf("expected 1 parser error, got=%d (%v)", len(p.Errors()), p.Errors())
+	}
+
+	if len(program.Statements) != 1 || program.Statements[0].String() != "var x = 1;" {
+		t.Fatalf("wrong statements after recovery. got=%q", program.String())
+	}
+}
+
+func TestLoopStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"while (x < 10) { x }", "while (x < 10) x"},
+		{"for (var i = 0; i < 10; f(i)) { i }", "for (var i = 0; (i < 10); f(i)) i"},
+		{"for (;;) { break; }", "for (; ; ) break;"},
+		{"for (g(); ; ) { continue }", "for (g(); ; ) continue;"},
+		{"for (x in [1, 2]) { x }", "for (x in [1, 2]) x"},
+		{"while (true) { if (x) { break; } continue; }", "while true if x break;continue;"},
+		{"while (x < 10) { x };", "while (x < 10) x"},
+		{"for (;;) { break; };", "for (; ; ) break;"},
+		{"for (x in xs) { x };;", "for (x in xs) x"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statements. got=%d", len(program.Statements))
+		}
+
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+
+	l := lexer.New("for (x in xs) { x }")
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	forIn, ok := program.Statements[0].(*ast.ForInStatement)
+	if !ok {
+		t.Fatalf("statement is not ast.ForInStatement. got=%T", program.Statements[0])
+	}
+	testIdentifier(t, forIn.Variable, "x")
+	testIdentifier(t, forIn.Iterable, "xs")
+}
+
+func TestBreakOutsideLoop(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"break;", "1:1: break outside of loop"},
+		{"if (true) { continue; }", "1:13: continue outside of loop"},
+		{"while (true) { fun() { break; } }", "1:24: break outside of loop"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != 1 {
+			t.Fatalf("expected 1 parser error for %q, got=%d", tt.input, len(errors))
+		}
+
+		if errors[0].Error() != tt.expected {
+			t.Errorf("wrong error. want=%q, got=%q", tt.expected, errors[0].Error())
+		}
+	}
+}
+
+func TestTryAndThrowStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`throw "boom";`, "throw boom;"},
+		{"throw {\"message\": m}", "throw {message: m};"},
+		{"try { f() } catch (e) { e }", "try f() catch (e) e"},
+		{"try { f() } finally { g() }", "try f() finally g()"},
+		{"try { f() } catch (e) { throw e } finally { g() }", "try f() catch (e) throw e; finally g()"},
+		{"try { f() } catch (e) { e };", "try f() catch (e) e"},
+		{"try { f() } finally { g() };", "try f() finally g()"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statements. got=%d", len(program.Statements))
+		}
+
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{"try { f() }", "1:12: Expected catch or finally after try block, got \"EOF\" instead"},
+		{"try { f() } catch { g() }", "1:19: Expected next token to be \"(\", got \"{\" instead"},
+		{"try { f() } catch (1) { g() }", "1:20: Expected next token to be \"IDENTIFIER\", got \"INT\" instead"},
+		{"try f()", "1:5: Expected next token to be \"{\", got \"IDENTIFIER\" instead"},
+	}
+
+	for _, tt := range errorTests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != 1 {
+			t.Fatalf("expected 1 parser error for %q, got=%d (%v)", tt.input, len(errors), errors)
+		}
+
+		if errors[0].Error() != tt.expected {
+			t.Errorf("wrong error. want=%q, got=%q", tt.expected, errors[0].Error())
+		}
+	}
+}
+
+func TestAssignExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		name     string
+		operator string
+		value    interface{}
+	}{
+		{"x = 5;", "x", "=", 5},
+		{"x += 5;", "x", "+=", 5},
+		{"x -= y;", "x", "-=", "y"},
+		{"x *= 2;", "x", "*=", 2},
+		{"x /= 2;", "x", "/=", 2},
+		{"x %= 2;", "x", "%=", 2},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		statement := program.Statements[0].(*ast.ExpressionStatement)
+		assign, ok := statement.Value.(*ast.AssignExpression)
+		if !ok {
+			t.Fatalf("statement is not ast.AssignExpression. got=%T", statement.Value)
+		}
+
+		testIdentifier(t, assign.Name, tt.name)
+		if assign.Operator != tt.operator {
+			t.Errorf("assign.Operator is not %q. got=%q", tt.operator, assign.Operator)
+		}
+		testLiteralExpression(t, assign.Value, tt.value)
+	}
+
+	l := lexer.New("1 = 2; a + b = c;")
+	p := New(l)
+	p.ParseProgram()
+
+	errors := p.Errors()
+	if len(errors) != 2 {
+		t.Fatalf("expected 2 parser errors, got=%d", len(errors))
+	}
+	if errors[0].Error() != "1:3: cannot assign to 1" {
+		t.Errorf("wrong error. got=%q", errors[0].Error())
+	}
+	if errors[1].Error() != "1:14: cannot assign to (a + b)" {
+		t.Errorf("wrong error. got=%q", errors[1].Error())
+	}
+}
+
 func TestIndexExpression(t *testing.T) {
 	input := "arr[1+2]"
 
@@ -765,6 +1252,124 @@ func TestIndexExpression(t *testing.T) {
 	}
 }
 
+func TestParserErrorPositions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"var = 5;", "1:5: Expected next token to be \"IDENTIFIER\", got \"=\" instead"},
+		{"var x = 1;\n  var y 2;", "2:9: Expected next token to be \"=\", got \"INT\" instead"},
+		{"\n\n   ]", "3:4: no prefix parse function for ] found"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Fatalf("expected parser errors for %q", tt.input)
+		}
+
+		if errors[0].Error() != tt.expected {
+			t.Errorf("wrong error. want=%q, got=%q", tt.expected, errors[0].Error())
+		}
+	}
+}
+
+func TestParserErrorRecovery(t *testing.T) {
+	input := `
+var = 1;
+var a = 2;
+var b 3;
+var f = fun(x, 1) { x };
+var g = fun() {
+  var = 4;
+  return 5;
+};
+a + ;
+if (true) { 1 + ; }
+foo(;
+fun h() { if (true) { 1 + ; } bar(; }
+var c = a;
+`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+
+	errors := p.Errors()
+	expectedErrors := []struct {
+		line     int
+		expected string
+		actual   string
+	}{
+		{2, "IDENTIFIER", "="},
+		{4, "=", "3"},
+		{5, "IDENTIFIER", "1"},
+		{7, "IDENTIFIER", "="},
+		{10, "", ";"},
+		{11, "", ";"},
+		{12, "", ";"},
+		{13, "", ";"},
+		{13, "", ";"},
+	}
+
+	if len(errors) != len(expectedErrors) {
+		for _, err := range errors {
+			t.Logf("parser error: %q", err)
+		}
+		t.Fatalf("wrong number of errors. want=%d, got=%d", len(expectedErrors), len(errors))
+	}
+
+	for i, tt := range expectedErrors {
+		err := errors[i]
+		if err.Pos.Line != tt.line {
+			t.Errorf("errors[%d] wrong line. want=%d, got=%d", i, tt.line, err.Pos.Line)
+		}
+		if string(err.Expected) != tt.expected {
+			t.Errorf("errors[%d] wrong expected token. want=%q, got=%q", i, tt.expected, err.Expected)
+		}
+		if err.Actual.Literal != tt.actual {
+			t.Errorf("errors[%d] wrong actual token. want=%q, got=%q", i, tt.actual, err.Actual.Literal)
+		}
+	}
+
+	expectedStatements := []string{"var a = 2;", "var c = a;"}
+	if len(program.Statements) != len(expectedStatements) {
+		t.Fatalf("wrong number of statements. want=%d, got=%d (%q)", len(expectedStatements), len(program.Statements), program.String())
+	}
+
+	for i, statement := range program.Statements {
+		if statement == nil {
+			t.Fatalf("program.Statements[%d] is nil", i)
+		}
+		if statement.String() != expectedStatements[i] {
+			t.Errorf("program.Statements[%d] wrong. want=%q, got=%q", i, expectedStatements[i], statement.String())
+		}
+	}
+}
+
+func TestNodePositions(t *testing.T) {
+	input := "var x = 1;\nx + add(2);"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	infix := program.Statements[1].(*ast.ExpressionStatement).Value.(*ast.InfixExpression)
+	if pos := infix.Pos(); pos.Line != 2 || pos.Column != 3 {
+		t.Errorf("infix position wrong. want=2:3, got=%s", pos)
+	}
+
+	call := infix.Right.(*ast.CallExpression)
+	if pos := call.Function.Pos(); pos.Line != 2 || pos.Column != 5 {
+		t.Errorf("call function position wrong. want=2:5, got=%s", pos)
+	}
+}
+
 func checkParserErrors(t *testing.T, parsr *Parser) {
 	errors := parsr.Errors()
 	if len(errors) == 0 {
@@ -0,0 +1,262 @@
+package resolver
+
+import (
+	"fmt"
+	"go-interpreter/ast"
+	"go-interpreter/token"
+)
+
+// Error is a variable used where no declaration of it can be seen.
+type Error struct {
+	Pos     token.Position
+	Name    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Pos, e.Message)
+}
+
+// scope mirrors an environment the evaluator creates: the global one, or the
+// one of a function call or catch block, whose variables get slots.
+type scope struct {
+	names  map[string]int
+	global bool
+}
+
+type Resolver struct {
+	scopes  []*scope
+	defined func(name string) bool
+	errors  []*Error
+}
+
+// Resolve gives the local variables of program their (depth, slot) and reports
+// the names that are never declared. defined tells which globals exist before
+// the program runs, like builtins, it may be nil.
+//
+// A local is its slot in the whole of its scope, so using it before its var has
+// run is an error at runtime, not a use of an outer variable of the same name.
+func Resolve(program *ast.Program, defined func(name string) bool) []*Error {
+	r := &Resolver{defined: defined}
+
+	r.push(true)
+	r.declareAll(program.Statements)
+	r.statements(program.Statements)
+	r.pop()
+
+	return r.errors
+}
+
+func (r *Resolver) statements(statements []ast.Statement) {
+	for _, statement := range statements {
+		r.statement(statement)
+	}
+}
+
+func (r *Resolver) statement(node ast.Statement) {
+	switch node := node.(type) {
+	case *ast.ExpressionStatement:
+		r.expression(node.Value)
+	case *ast.BlockStatement:
+		r.statements(node.Statements)
+	case *ast.VarStatement:
+		r.expression(node.Value)
+		r.declare(node.Name)
+	case *ast.FunctionStatement:
+		r.declare(node.Name)
+		r.function(node.Function)
+	case *ast.ReturnStatement:
+		r.expression(node.ReturnValue)
+	case *ast.ThrowStatement:
+		r.expression(node.Value)
+	case *ast.WhileStatement:
+		r.expression(node.Condition)
+		r.statements(node.Body.Statements)
+	case *ast.ForStatement:
+		if node.Init != nil {
+			r.statement(node.Init)
+		}
+		r.expression(node.Condition)
+		r.expression(node.Step)
+		r.statements(node.Body.Statements)
+	case *ast.ForInStatement:
+		r.expression(node.Iterable)
+		r.declare(node.Variable)
+		r.statements(node.Body.Statements)
+	case *ast.TryStatement:
+		r.statements(node.Block.Statements)
+		if node.Catch != nil {
+			r.push(false)
+			r.declare(node.Param)
+			r.declareAll(node.Catch.Statements)
+			r.statements(node.Catch.Statements)
+			node.CatchSlots = len(r.current().names)
+			r.pop()
+		}
+		if node.Finally != nil {
+			r.statements(node.Finally.Statements)
+		}
+	}
+}
+
+func (r *Resolver) expression(node ast.Expression) {
+	switch node := node.(type) {
+	case *ast.Identifier:
+		r.use(node)
+	case *ast.PrefixExpression:
+		r.expression(node.Right)
+	case *ast.InfixExpression:
+		r.expression(node.Left)
+		r.expression(node.Right)
+	case *ast.AssignExpression:
+		r.use(node.Name)
+		r.expression(node.Value)
+	case *ast.IfExpression:
+		r.expression(node.Condition)
+		r.statements(node.Consequence.Statements)
+		if node.Alternative != nil {
+			r.statements(node.Alternative.Statements)
+		}
+	case *ast.FunctionLiteral:
+		r.function(node)
+	case *ast.CallExpression:
+		r.expression(node.Function)
+		for _, argument := range node.Arguments {
+			r.expression(argument)
+		}
+	case *ast.ArrayLiteral:
+		for _, element := range node.Elements {
+			r.expression(element)
+		}
+	case *ast.HashLiteral:
+		for _, pair := range node.Pairs {
+			r.expression(pair.Key)
+			r.expression(pair.Value)
+		}
+	case *ast.IndexExpression:
+		r.expression(node.Left)
+		r.expression(node.Index)
+	case *ast.SpreadExpression:
+		r.expression(node.Value)
+	}
+}
+
+// function resolves a function literal in its own scope. Defaults are resolved
+// there too, as they are evaluated in the environment of the call.
+func (r *Resolver) function(node *ast.FunctionLiteral) {
+	r.push(false)
+
+	for _, parameter := range node.Parameters {
+		r.declare(parameter)
+	}
+	if node.Rest != nil {
+		r.declare(node.Rest)
+	}
+	r.declareAll(node.Body.Statements)
+
+	for _, value := range node.Defaults {
+		if value != nil {
+			r.expression(value)
+		}
+	}
+	r.statements(node.Body.Statements)
+
+	node.Slots = len(r.current().names)
+	r.pop()
+}
+
+// declareAll declares up front the variables statements declare outside of
+// nested functions and catch blocks, so a closure can use a variable declared
+// after it.
+func (r *Resolver) declareAll(statements []ast.Statement) {
+	for _, statement := range statements {
+		switch statement := statement.(type) {
+		case *ast.VarStatement:
+			r.declare(statement.Name)
+		case *ast.FunctionStatement:
+			r.declare(statement.Name)
+		case *ast.ExpressionStatement:
+			if ifExpression, ok := statement.Value.(*ast.IfExpression); ok {
+				r.declareAll(ifExpression.Consequence.Statements)
+				if ifExpression.Alternative != nil {
+					r.declareAll(ifExpression.Alternative.Statements)
+				}
+			}
+		case *ast.BlockStatement:
+			r.declareAll(statement.Statements)
+		case *ast.WhileStatement:
+			r.declareAll(statement.Body.Statements)
+		case *ast.ForStatement:
+			if statement.Init != nil {
+				r.declareAll([]ast.Statement{statement.Init})
+			}
+			r.declareAll(statement.Body.Statements)
+		case *ast.ForInStatement:
+			r.declare(statement.Variable)
+			r.declareAll(statement.Body.Statements)
+		case *ast.TryStatement:
+			r.declareAll(statement.Block.Statements)
+			if statement.Finally != nil {
+				r.declareAll(statement.Finally.Statements)
+			}
+		}
+	}
+}
+
+// declare adds identifier to the current scope, declaring a name again keeps its slot.
+func (r *Resolver) declare(identifier *ast.Identifier) {
+	scope := r.current()
+
+	slot, ok := scope.names[identifier.Value]
+	if !ok {
+		slot = len(scope.names)
+		scope.names[identifier.Value] = slot
+	}
+
+	if !scope.global {
+		identifier.Resolved = true
+		identifier.Depth = 0
+		identifier.Slot = slot
+	}
+}
+
+// use resolves identifier to the closest declaration. Globals stay looked up by name.
+func (r *Resolver) use(identifier *ast.Identifier) {
+	depth := 0
+	for i := len(r.scopes) - 1; i >= 0; i-- {
+		scope := r.scopes[i]
+		slot, ok := scope.names[identifier.Value]
+
+		if scope.global {
+			if !ok && (r.defined == nil || !r.defined(identifier.Value)) {
+				r.errors = append(r.errors, &Error{
+					Pos:     identifier.Pos(),
+					Name:    identifier.Value,
+					Message: fmt.Sprintf("use of undeclared variable: %s", identifier.Value),
+				})
+			}
+			identifier.Resolved = false
+			return
+		}
+
+		if ok {
+			identifier.Resolved = true
+			identifier.Depth = depth
+			identifier.Slot = slot
+			return
+		}
+		depth++
+	}
+}
+
+func (r *Resolver) push(global bool) {
+	r.scopes = append(r.scopes, &scope{names: make(map[string]int), global: global})
+}
+
+func (r *Resolver) pop() {
+	r.scopes = r.scopes[:len(r.scopes)-1]
+}
+
+func (r *Resolver) current() *scope {
+	return r.scopes[len(r.scopes)-1]
+}
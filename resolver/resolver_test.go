@@ -0,0 +1,102 @@
+package resolver
+
+import (
+	"go-interpreter/ast"
+	"go-interpreter/lexer"
+	"go-interpreter/parser"
+	"testing"
+)
+
+func TestResolveSlots(t *testing.T) {
+	input := `
+var g = 1;
+fun outer(a, b) {
+	var c = a;
+	fun() { a + c + g }
+}
+try { 1 } catch (e) { fun() { e } }
+`
+	program := parse(t, input)
+	if errors := Resolve(program, nil); len(errors) != 0 {
+		t.Fatalf("unexpected errors: %v", errors)
+	}
+
+	outer := program.Statements[1].(*ast.FunctionStatement).Function
+	if outer.Slots != 3 {
+		t.Errorf("outer has wrong number of slots, got=%d", outer.Slots)
+	}
+
+	inner := outer.Body.Statements[1].(*ast.ExpressionStatement).Value.(*ast.FunctionLiteral)
+	sum := inner.Body.Statements[0].(*ast.ExpressionStatement).Value.(*ast.InfixExpression)
+	left := sum.Left.(*ast.InfixExpression)
+
+	tests := []struct {
+		identifier *ast.Expression
+		resolved   bool
+		depth      int
+		slot       int
+	}{
+		{&left.Left, true, 1, 0},
+		{&left.Right, true, 1, 2},
+		{&sum.Right, false, 0, 0},
+	}
+
+	for _, tt := range tests {
+		identifier := (*tt.identifier).(*ast.Identifier)
+		if identifier.Resolved != tt.resolved || identifier.Depth != tt.depth || identifier.Slot != tt.slot {
+			t.Errorf("%s resolved wrongly, got=(%t, %d, %d), want=(%t, %d, %d)", identifier.Value,
+				identifier.Resolved, identifier.Depth, identifier.Slot, tt.resolved, tt.depth, tt.slot)
+		}
+	}
+
+	try := program.Statements[2].(*ast.TryStatement)
+	if try.CatchSlots != 1 {
+		t.Errorf("catch block has wrong number of slots, got=%d", try.CatchSlots)
+	}
+	caught := try.Catch.Statements[0].(*ast.ExpressionStatement).Value.(*ast.FunctionLiteral)
+	e := caught.Body.Statements[0].(*ast.ExpressionStatement).Value.(*ast.Identifier)
+	if !e.Resolved || e.Depth != 1 || e.Slot != 0 {
+		t.Errorf("catch parameter resolved wrongly, got=(%t, %d, %d)", e.Resolved, e.Depth, e.Slot)
+	}
+}
+
+func TestUndeclaredVariables(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"x + 1", []string{"1:1: use of undeclared variable: x"}},
+		{"var a = 1; a = b", []string{"1:16: use of undeclared variable: b"}},
+		{"fun f() { g() }; fun g() { f() }", nil},
+		{"fun f() { var x = 1 }; x", []string{"1:24: use of undeclared variable: x"}},
+		{"try { 1 } catch (e) { var inside = e } inside", []string{"1:40: use of undeclared variable: inside"}},
+		{"len([1]) + later; var later = 1", nil},
+		{"fun() { y = 1 }", []string{"1:9: use of undeclared variable: y"}},
+	}
+
+	defined := func(name string) bool { return name == "len" }
+
+	for _, tt := range tests {
+		errors := Resolve(parse(t, tt.input), defined)
+		if len(errors) != len(tt.expected) {
+			t.Errorf("%q: wrong number of errors, got=%v, want=%v", tt.input, errors, tt.expected)
+			continue
+		}
+		for i, err := range errors {
+			if err.Error() != tt.expected[i] {
+				t.Errorf("%q: wrong error, got=%q, want=%q", tt.input, err.Error(), tt.expected[i])
+			}
+		}
+	}
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	return program
+}
@@ -1,11 +1,41 @@
 package token
 
+import "fmt"
+
 // todo)) switch to int or byte
 type TokenType string
 
 type Token struct {
 	Type    TokenType
 	Literal string
+	Pos     Position
+}
+
+// Position is a location in the source. Line and Column are 1-based,
+// Column counts characters (runes) and Offset is the byte offset into the input.
+type Position struct {
+	File   string
+	Line   int
+	Column int
+	Offset int
+}
+
+func (p Position) IsValid() bool {
+	return p.Line > 0
+}
+
+func (p Position) String() string {
+	if !p.IsValid() {
+		if p.File != "" {
+			return p.File
+		}
+		return "-"
+	}
+
+	if p.File != "" {
+		return fmt.Sprintf("%s:%d:%d", p.File, p.Line, p.Column)
+	}
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
 }
 
 func New(tokenType TokenType, literal string) Token {
@@ -23,21 +53,32 @@ func LookupIdentifier(identifier string) TokenType {
 }
 
 var keywords = map[string]TokenType{
-	"fun":    FUNCTION,
-	"var":    VAR,
-	"true":   TRUE,
-	"false":  FALSE,
-	"if":     IF,
-	"else":   ELSE,
-	"return": RETURN,
+	"fun":      FUNCTION,
+	"var":      VAR,
+	"true":     TRUE,
+	"false":    FALSE,
+	"if":       IF,
+	"else":     ELSE,
+	"return":   RETURN,
+	"while":    WHILE,
+	"for":      FOR,
+	"in":       IN,
+	"break":    BREAK,
+	"continue": CONTINUE,
+	"throw":    THROW,
+	"try":      TRY,
+	"catch":    CATCH,
+	"finally":  FINALLY,
 }
 
 const (
 	ILLEGAL = "ILLEGAL"
 	EOF     = "EOF"
+	COMMENT = "COMMENT"
 
 	IDENTIFIER = "IDENTIFIER"
 	INT        = "INT"
+	FLOAT      = "FLOAT"
 
 	ASSIGN         = "="
 	PLUS           = "+"
@@ -49,12 +90,32 @@ const (
 	LESS_EQUALS    = "<="
 	GREATER_THAN   = ">"
 	GREATER_EQUALS = ">="
+	PERCENT        = "%"
+	POWER          = "**"
+
+	BIT_AND     = "&"
+	BIT_OR      = "|"
+	BIT_XOR     = "^"
+	SHIFT_LEFT  = "<<"
+	SHIFT_RIGHT = ">>"
+	TILDE       = "~"
 
 	EQUALS     = "=="
 	NOT_EQUALS = "!="
 
+	AND = "&&"
+	OR  = "||"
+
+	PLUS_ASSIGN     = "+="
+	MINUS_ASSIGN    = "-="
+	ASTERISK_ASSIGN = "*="
+	SLASH_ASSIGN    = "/="
+	PERCENT_ASSIGN  = "%="
+
 	COMMA     = ","
 	SEMICOLON = ";"
+	COLON     = ":"
+	ELLIPSIS  = "..."
 
 	LEFT_PAREN    = "("
 	RIGHT_PAREN   = ")"
@@ -70,6 +131,15 @@ const (
 	IF       = "IF"
 	ELSE     = "ELSE"
 	RETURN   = "RETURN"
+	WHILE    = "WHILE"
+	FOR      = "FOR"
+	IN       = "IN"
+	BREAK    = "BREAK"
+	CONTINUE = "CONTINUE"
+	THROW    = "THROW"
+	TRY      = "TRY"
+	CATCH    = "CATCH"
+	FINALLY  = "FINALLY"
 
 	STRING = "STRING"
 )
@@ -0,0 +1,582 @@
+package vm
+
+import (
+	"fmt"
+	"go-interpreter/code"
+	"go-interpreter/compiler"
+	"go-interpreter/eval"
+	"go-interpreter/object"
+)
+
+const StackSize = 2048
+
+var (
+	TRUE  = eval.TRUE
+	FALSE = eval.FALSE
+	NULL  = eval.NULL
+)
+
+type VM struct {
+	globals     []object.Object
+	globalNames []string
+
+	// stack grows when a program needs more room, sp points to the next free slot
+	stack []object.Object
+	sp    int
+
+	frames   []*Frame
+	handlers []handler
+}
+
+// Frame is a running function call.
+type Frame struct {
+	cl  *object.Closure
+	ip  int
+	env *object.Scope
+	// basePointer is where the called closure sits on the stack, its result replaces it
+	basePointer int
+	// callSite is the offset of the call instruction in the calling frame
+	callSite int
+}
+
+// handler is where a try statement resumes when an error is raised.
+type handler struct {
+	frame int
+	ip    int
+	sp    int
+}
+
+// iterator walks the items of a for-in loop, it only ever lives on the stack.
+type iterator struct {
+	items []object.Object
+	next  int
+}
+
+func (it *iterator) Type() object.ObjectType {
+	return "ITERATOR"
+}
+
+func (it *iterator) Inspect() string {
+	return "iterator"
+}
+
+func New(bytecode *compiler.Bytecode) *VM {
+	return NewWithGlobals(bytecode, nil)
+}
+
+// NewWithGlobals runs bytecode against globals left by an earlier program, for
+// the REPL. globals grows to fit the globals of bytecode, Globals returns it.
+func NewWithGlobals(bytecode *compiler.Bytecode, globals []object.Object) *VM {
+	main := &object.Closure{Fn: bytecode.Main, Env: &object.Scope{}}
+	if missing := len(bytecode.Globals) - len(globals); missing > 0 {
+		globals = append(globals, make([]object.Object, missing)...)
+	}
+
+	return &VM{
+		globals:     globals,
+		globalNames: bytecode.Globals,
+		stack:       make([]object.Object, StackSize),
+		frames:      []*Frame{{cl: main, env: main.Env}},
+	}
+}
+
+// Globals are the values of the globals, to run the next program against.
+func (vm *VM) Globals() []object.Object {
+	return vm.globals
+}
+
+// Run executes the program and returns the value of its last statement, nil
+// if it has none, or the error that stopped it.
+func (vm *VM) Run() (result object.Object) {
+	frame := vm.currentFrame()
+	ins := frame.cl.Fn.Instructions
+
+	defer func() {
+		if r := recover(); r != nil {
+			err := eval.NewError("internal error: %v", r)
+			frame := vm.currentFrame()
+			err.Pos = frame.cl.Fn.Positions.Lookup(frame.ip)
+			result = err
+		}
+	}()
+
+	for {
+		ip := frame.ip
+		op := code.Opcode(ins[ip])
+		var err *object.Error
+
+		switch op {
+		case code.OpConstant:
+			frame.ip = ip + 3
+			vm.push(frame.cl.Fn.Constants[code.ReadUint16(ins[ip+1:])])
+		case code.OpPop:
+			frame.ip = ip + 1
+			vm.sp--
+			vm.stack[vm.sp] = nil
+
+		case code.OpTrue:
+			frame.ip = ip + 1
+			vm.push(TRUE)
+		case code.OpFalse:
+			frame.ip = ip + 1
+			vm.push(FALSE)
+		case code.OpNull:
+			frame.ip = ip + 1
+			vm.push(NULL)
+
+		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv, code.OpMod, code.OpPow,
+			code.OpBitAnd, code.OpBitOr, code.OpBitXor, code.OpShiftLeft, code.OpShiftRight,
+			code.OpEqual, code.OpNotEqual, code.OpLessThan, code.OpLessEqual, code.OpGreaterThan, code.OpGreaterEqual:
+			frame.ip = ip + 1
+			err = vm.executeBinaryOperation(op)
+
+		case code.OpMinus:
+			frame.ip = ip + 1
+			if integer, ok := vm.stack[vm.sp-1].(*object.Integer); ok {
+				vm.stack[vm.sp-1] = &object.Integer{Value: -integer.Value}
+			} else {
+				err = vm.executePrefixOperation("-")
+			}
+		case code.OpBang:
+			frame.ip = ip + 1
+			if vm.stack[vm.sp-1] == TRUE {
+				vm.stack[vm.sp-1] = FALSE
+			} else {
+				vm.stack[vm.sp-1] = TRUE
+			}
+		case code.OpTilde:
+			frame.ip = ip + 1
+			err = vm.executePrefixOperation("~")
+
+		case code.OpJump:
+			frame.ip = int(code.ReadUint16(ins[ip+1:]))
+		case code.OpJumpNotTruthy:
+			if vm.pop() != TRUE {
+				frame.ip = int(code.ReadUint16(ins[ip+1:]))
+			} else {
+				frame.ip = ip + 3
+			}
+
+		case code.OpGetGlobal:
+			frame.ip = ip + 3
+			index := code.ReadUint16(ins[ip+1:])
+			if value := vm.globals[index]; value != nil {
+				vm.push(value)
+			} else if builtin, ok := eval.LookupBuiltin(vm.globalNames[index]); ok {
+				vm.push(builtin)
+			} else {
+				err = eval.NewError("identifier not found: %s", vm.globalNames[index])
+			}
+		case code.OpDefineGlobal:
+			frame.ip = ip + 3
+			vm.globals[code.ReadUint16(ins[ip+1:])] = vm.pop()
+		case code.OpAssignGlobal:
+			frame.ip = ip + 3
+			vm.globals[code.ReadUint16(ins[ip+1:])] = vm.stack[vm.sp-1]
+		case code.OpCheckGlobal:
+			frame.ip = ip + 3
+			index := code.ReadUint16(ins[ip+1:])
+			if vm.globals[index] == nil {
+				err = eval.NewError("assignment to undeclared variable: %s", vm.globalNames[index])
+			}
+
+		case code.OpGetLocal:
+			frame.ip = ip + 3
+			index := code.ReadUint16(ins[ip+1:])
+			if value := frame.env.Slots[index]; value != nil {
+				vm.push(value)
+			} else {
+				err = eval.NewError("identifier not found: %s", frame.cl.Fn.LocalNames[index])
+			}
+		case code.OpDefineLocal:
+			frame.ip = ip + 3
+			frame.env.Slots[code.ReadUint16(ins[ip+1:])] = vm.pop()
+		case code.OpAssignLocal:
+			frame.ip = ip + 3
+			frame.env.Slots[code.ReadUint16(ins[ip+1:])] = vm.stack[vm.sp-1]
+		case code.OpCheckLocal:
+			frame.ip = ip + 3
+			index := code.ReadUint16(ins[ip+1:])
+			if frame.env.Slots[index] == nil {
+				err = eval.NewError("assignment to undeclared variable: %s", frame.cl.Fn.LocalNames[index])
+			}
+		case code.OpGetFree:
+			frame.ip = ip + 4
+			scope := outerScope(frame.env, int(code.ReadUint8(ins[ip+1:])))
+			if value := scope.Slots[code.ReadUint16(ins[ip+2:])]; value != nil {
+				vm.push(value)
+			} else {
+				err = eval.NewError("identifier not found: %s", frame.cl.Fn.Names[ip])
+			}
+		case code.OpAssignFree:
+			frame.ip = ip + 4
+			scope := outerScope(frame.env, int(code.ReadUint8(ins[ip+1:])))
+			scope.Slots[code.ReadUint16(ins[ip+2:])] = vm.stack[vm.sp-1]
+		case code.OpCheckFree:
+			frame.ip = ip + 4
+			scope := outerScope(frame.env, int(code.ReadUint8(ins[ip+1:])))
+			if scope.Slots[code.ReadUint16(ins[ip+2:])] == nil {
+				err = eval.NewError("assignment to undeclared variable: %s", frame.cl.Fn.Names[ip])
+			}
+		case code.OpJumpIfBound:
+			if frame.env.Slots[code.ReadUint16(ins[ip+1:])] != nil {
+				frame.ip = int(code.ReadUint16(ins[ip+3:]))
+			} else {
+				frame.ip = ip + 5
+			}
+
+		case code.OpArray:
+			frame.ip = ip + 3
+			n := int(code.ReadUint16(ins[ip+1:]))
+			elements := make([]object.Object, n)
+			copy(elements, vm.stack[vm.sp-n:vm.sp])
+			vm.sp -= n
+			vm.push(&object.Array{Elements: elements})
+		case code.OpHash:
+			frame.ip = ip + 3
+			n := int(code.ReadUint16(ins[ip+1:]))
+			var hash object.Object
+			hash, err = vm.buildHash(vm.sp-2*n, vm.sp)
+			vm.sp -= 2 * n
+			vm.push(hash)
+		case code.OpAppend:
+			frame.ip = ip + 1
+			value := vm.pop()
+			array := vm.stack[vm.sp-1].(*object.Array)
+			array.Elements = append(array.Elements, value)
+		case code.OpExtend:
+			frame.ip = ip + 1
+			value := vm.pop()
+			spread, ok := value.(*object.Array)
+			if !ok {
+				err = eval.NewError("cannot spread %s, expected Array", value.Type())
+				break
+			}
+			array := vm.stack[vm.sp-1].(*object.Array)
+			array.Elements = append(array.Elements, spread.Elements...)
+		case code.OpIndex:
+			frame.ip = ip + 1
+			index := vm.pop()
+			left := vm.pop()
+			result := eval.IndexOperation(left, index)
+			if isError(result) {
+				err = result.(*object.Error)
+				break
+			}
+			vm.push(result)
+
+		case code.OpClosure:
+			frame.ip = ip + 3
+			fn := frame.cl.Fn.Constants[code.ReadUint16(ins[ip+1:])].(*object.CompiledFunction)
+			vm.push(&object.Closure{Fn: fn, Env: frame.env})
+		case code.OpCall:
+			frame.ip = ip + 3
+			err = vm.callFunction(int(code.ReadUint16(ins[ip+1:])), ip)
+			frame = vm.currentFrame()
+			ins = frame.cl.Fn.Instructions
+		case code.OpCallSpread:
+			frame.ip = ip + 1
+			args := vm.pop().(*object.Array)
+			for _, arg := range args.Elements {
+				vm.push(arg)
+			}
+			err = vm.callFunction(len(args.Elements), ip)
+			frame = vm.currentFrame()
+			ins = frame.cl.Fn.Instructions
+		case code.OpReturnValue, code.OpReturn:
+			value := object.Object(NULL)
+			if op == code.OpReturnValue {
+				value = vm.pop()
+			}
+
+			if len(vm.frames) == 1 {
+				if op == code.OpReturn {
+					return nil
+				}
+				return value
+			}
+
+			vm.frames = vm.frames[:len(vm.frames)-1]
+			vm.sp = frame.basePointer
+			vm.push(value)
+			frame = vm.currentFrame()
+			ins = frame.cl.Fn.Instructions
+
+		case code.OpIter:
+			frame.ip = ip + 1
+			items, iterErr := eval.IterationItems(vm.pop())
+			if iterErr != nil {
+				err = iterErr
+				break
+			}
+			vm.push(&iterator{items: items})
+		case code.OpIterNext:
+			it := vm.stack[vm.sp-1].(*iterator)
+			if it.next >= len(it.items) {
+				frame.ip = int(code.ReadUint16(ins[ip+1:]))
+				break
+			}
+			frame.ip = ip + 3
+			vm.push(it.items[it.next])
+			it.next++
+
+		case code.OpSetupTry:
+			frame.ip = ip + 3
+			vm.handlers = append(vm.handlers, handler{
+				frame: len(vm.frames) - 1,
+				ip:    int(code.ReadUint16(ins[ip+1:])),
+				sp:    vm.sp,
+			})
+		case code.OpPopTry:
+			frame.ip = ip + 1
+			vm.handlers = vm.handlers[:len(vm.handlers)-1]
+		case code.OpCatch:
+			frame.ip = ip + 1
+			vm.stack[vm.sp-1] = eval.CaughtError(vm.stack[vm.sp-1].(*object.Error))
+		case code.OpThrow:
+			frame.ip = ip + 1
+			err = eval.ThrownError(vm.pop())
+		case code.OpRethrow:
+			frame.ip = ip + 1
+			err = vm.pop().(*object.Error)
+		case code.OpError:
+			frame.ip = ip + 3
+			message := frame.cl.Fn.Constants[code.ReadUint16(ins[ip+1:])].(*object.String)
+			err = eval.NewError("%s", message.Value)
+
+		default:
+			def, _ := code.Lookup(byte(op))
+			panic(fmt.Sprintf("unknown opcode %v", def))
+		}
+
+		if err != nil {
+			if !vm.raise(err, ip) {
+				return err
+			}
+			frame = vm.currentFrame()
+			ins = frame.cl.Fn.Instructions
+		}
+	}
+}
+
+// raise hands err to the innermost try statement, unwinding the calls above it
+// and recording them in the error's stack. It reports false if nothing catches err.
+func (vm *VM) raise(err *object.Error, ip int) bool {
+	frame := vm.currentFrame()
+	if !err.Pos.IsValid() {
+		err.Pos = frame.cl.Fn.Positions.Lookup(ip)
+	}
+
+	target := 0
+	if len(vm.handlers) > 0 {
+		target = vm.handlers[len(vm.handlers)-1].frame
+	}
+
+	for len(vm.frames)-1 > target {
+		frame := vm.currentFrame()
+		caller := vm.frames[len(vm.frames)-2]
+		err.Stack = append(err.Stack, object.Frame{
+			Function: vm.calleeName(frame.cl.Fn, caller, frame.callSite),
+			CallSite: caller.cl.Fn.Positions.Lookup(frame.callSite),
+		})
+		vm.frames = vm.frames[:len(vm.frames)-1]
+	}
+
+	if len(vm.handlers) == 0 {
+		return false
+	}
+
+	h := vm.handlers[len(vm.handlers)-1]
+	vm.handlers = vm.handlers[:len(vm.handlers)-1]
+
+	for i := h.sp; i < vm.sp; i++ {
+		vm.stack[i] = nil
+	}
+	vm.sp = h.sp
+	vm.push(err)
+	vm.currentFrame().ip = h.ip
+	return true
+}
+
+// callFunction calls the callee below the argc arguments on top of the stack,
+// the call instruction being at callSite in the current frame.
+func (vm *VM) callFunction(argc int, callSite int) *object.Error {
+	caller := vm.currentFrame()
+
+	switch callee := vm.stack[vm.sp-1-argc].(type) {
+	case *object.Closure:
+		fn := callee.Fn
+		min, max := fn.Arity()
+		if argc < min || (max != -1 && argc > max) {
+			return eval.ArityError(vm.calleeName(fn, caller, callSite), min, max, argc)
+		}
+
+		env := &object.Scope{Slots: make([]object.Object, fn.NumLocals), Outer: callee.Env}
+		args := vm.stack[vm.sp-argc : vm.sp]
+		if fn.Variadic {
+			rest := []object.Object{}
+			if argc > fn.NumParameters {
+				rest = append(rest, args[fn.NumParameters:]...)
+				args = args[:fn.NumParameters]
+			}
+			env.Slots[fn.NumParameters] = &object.Array{Elements: rest}
+		}
+		copy(env.Slots, args)
+
+		vm.sp -= argc
+		vm.frames = append(vm.frames, &Frame{cl: callee, env: env, basePointer: vm.sp - 1, callSite: callSite})
+		return nil
+	case *object.Builtin:
+		args := make([]object.Object, argc)
+		copy(args, vm.stack[vm.sp-argc:vm.sp])
+		vm.sp -= argc + 1
+
+		result := callee.Fun(args...)
+		if isError(result) {
+			return result.(*object.Error)
+		}
+		vm.push(result)
+		return nil
+	default:
+		return eval.NewError("not a function: %s", callee.Type())
+	}
+}
+
+// calleeName names fn like the tree-walker does: by its declared name, or by
+// the identifier it was called through.
+func (vm *VM) calleeName(fn *object.CompiledFunction, caller *Frame, callSite int) string {
+	if fn.Name != "" {
+		return fn.Name
+	}
+	return caller.cl.Fn.Names[callSite]
+}
+
+func (vm *VM) executeBinaryOperation(op code.Opcode) *object.Error {
+	right := vm.stack[vm.sp-1]
+	left := vm.stack[vm.sp-2]
+	vm.sp--
+	vm.stack[vm.sp] = nil
+
+	if leftInteger, ok := left.(*object.Integer); ok {
+		if rightInteger, ok := right.(*object.Integer); ok {
+			if result := integerOperation(op, leftInteger.Value, rightInteger.Value); result != nil {
+				vm.stack[vm.sp-1] = result
+				return nil
+			}
+		}
+	}
+
+	result := eval.InfixOperation(binaryOperators[op], left, right)
+	if isError(result) {
+		return result.(*object.Error)
+	}
+	vm.stack[vm.sp-1] = result
+	return nil
+}
+
+// integerOperation is the fast path for the common integer operators, it
+// returns nil to leave the rest to the evaluator's rules.
+func integerOperation(op code.Opcode, left int64, right int64) object.Object {
+	switch op {
+	case code.OpAdd:
+		return &object.Integer{Value: left + right}
+	case code.OpSub:
+		return &object.Integer{Value: left - right}
+	case code.OpMul:
+		return &object.Integer{Value: left * right}
+	case code.OpEqual:
+		return nativeBoolToBooleanObject(left == right)
+	case code.OpNotEqual:
+		return nativeBoolToBooleanObject(left != right)
+	case code.OpLessThan:
+		return nativeBoolToBooleanObject(left < right)
+	case code.OpLessEqual:
+		return nativeBoolToBooleanObject(left <= right)
+	case code.OpGreaterThan:
+		return nativeBoolToBooleanObject(left > right)
+	case code.OpGreaterEqual:
+		return nativeBoolToBooleanObject(left >= right)
+	default:
+		return nil
+	}
+}
+
+var binaryOperators = map[code.Opcode]string{
+	code.OpAdd:          "+",
+	code.OpSub:          "-",
+	code.OpMul:          "*",
+	code.OpDiv:          "/",
+	code.OpMod:          "%",
+	code.OpPow:          "**",
+	code.OpBitAnd:       "&",
+	code.OpBitOr:        "|",
+	code.OpBitXor:       "^",
+	code.OpShiftLeft:    "<<",
+	code.OpShiftRight:   ">>",
+	code.OpEqual:        "==",
+	code.OpNotEqual:     "!=",
+	code.OpLessThan:     "<",
+	code.OpLessEqual:    "<=",
+	code.OpGreaterThan:  ">",
+	code.OpGreaterEqual: ">=",
+}
+
+func (vm *VM) executePrefixOperation(operator string) *object.Error {
+	result := eval.PrefixOperation(operator, vm.stack[vm.sp-1])
+	if isError(result) {
+		return result.(*object.Error)
+	}
+	vm.stack[vm.sp-1] = result
+	return nil
+}
+
+func (vm *VM) buildHash(start int, end int) (object.Object, *object.Error) {
+	hash := object.NewHash()
+
+	for i := start; i < end; i += 2 {
+		key, ok := vm.stack[i].(object.Hashable)
+		if !ok {
+			return nil, eval.NewError("unusable as hash key: %s", vm.stack[i].Type())
+		}
+		hash.Set(key, vm.stack[i+1])
+	}
+
+	return hash, nil
+}
+
+func outerScope(scope *object.Scope, depth int) *object.Scope {
+	for ; depth > 0; depth-- {
+		scope = scope.Outer
+	}
+	return scope
+}
+
+func (vm *VM) currentFrame() *Frame {
+	return vm.frames[len(vm.frames)-1]
+}
+
+func (vm *VM) push(obj object.Object) {
+	if vm.sp >= len(vm.stack) {
+		vm.stack = append(vm.stack, make([]object.Object, len(vm.stack))...)
+	}
+	vm.stack[vm.sp] = obj
+	vm.sp++
+}
+
+func (vm *VM) pop() object.Object {
+	vm.sp--
+	obj := vm.stack[vm.sp]
+	vm.stack[vm.sp] = nil
+	return obj
+}
+
+func nativeBoolToBooleanObject(input bool) *object.Boolean {
+	if input {
+		return TRUE
+	}
+	return FALSE
+}
+
+func isError(obj object.Object) bool {
+	return obj != nil && obj.Type() == object.ERROR_OBJECT
+}
@@ -0,0 +1,149 @@
+package vm
+
+import (
+	"go-interpreter/ast"
+	"go-interpreter/compiler"
+	"go-interpreter/internal/enginetest"
+	"go-interpreter/lexer"
+	"go-interpreter/object"
+	"go-interpreter/parser"
+	"testing"
+)
+
+func TestEngine(t *testing.T) {
+	enginetest.Run(t, testEval)
+}
+
+func TestRunRecoversPanics(t *testing.T) {
+	program := parse("var a = 1;\nboom();\na + 1")
+
+	symbolTable := compiler.NewSymbolTable()
+	boom := symbolTable.Define("boom")
+	globals := make([]object.Object, symbolTable.NumDefinitions())
+	globals[boom.Index] = &object.Builtin{Fun: func(args ...object.Object) object.Object {
+		var arr []object.Object
+		return arr[len(args)+1]
+	}}
+
+	comp := compiler.NewWithState(symbolTable, []object.Object{})
+	if err := comp.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	evaluated := NewWithGlobals(comp.Bytecode(), globals).Run()
+	errorObject, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("object is not Error, got=%T(%v)", evaluated, evaluated)
+	}
+
+	expected := "internal error: runtime error: index out of range [1] with length 0"
+	if errorObject.Message != expected {
+		t.Errorf("wrong error message, got=%q, want=%q", errorObject.Message, expected)
+	}
+
+	if errorObject.Pos.Line != 2 {
+		t.Errorf("wrong error position, got=%s", errorObject.Pos)
+	}
+}
+
+func TestGlobals(t *testing.T) {
+	symbolTable := compiler.NewSymbolTable()
+	constants := []object.Object{}
+
+	comp := compiler.NewWithState(symbolTable, constants)
+	if err := comp.Compile(parse("var a = 1; var b = 2")); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	machine := New(comp.Bytecode())
+	machine.Run()
+
+	// sized for the program, not for every global there could be
+	if len(machine.Globals()) != 2 {
+		t.Fatalf("wrong number of globals, got=%d, want=2", len(machine.Globals()))
+	}
+
+	comp = compiler.NewWithState(symbolTable, comp.Bytecode().Constants)
+	if err := comp.Compile(parse("var c = a + b; c")); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	machine = NewWithGlobals(comp.Bytecode(), machine.Globals())
+	enginetest.IntegerObject(t, machine.Run(), 3)
+
+	if len(machine.Globals()) != 3 {
+		t.Errorf("globals didn't grow, got=%d, want=3", len(machine.Globals()))
+	}
+}
+
+func TestFunctionsKeepTheirConstants(t *testing.T) {
+	symbolTable := compiler.NewSymbolTable()
+
+	comp := compiler.NewWithState(symbolTable, []object.Object{})
+	if err := comp.Compile(parse(`var f = fun(x) { x + 40 }; var s = "unused"`)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	machine := New(comp.Bytecode())
+	machine.Run()
+
+	// the next program starts over with constants of its own
+	comp = compiler.NewWithState(symbolTable, []object.Object{})
+	if err := comp.Compile(parse("f(2)")); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	machine = NewWithGlobals(comp.Bytecode(), machine.Globals())
+	enginetest.IntegerObject(t, machine.Run(), 42)
+}
+
+func TestFunctionObject(t *testing.T) {
+	input := "fun(x) { x + 2; };"
+
+	evaluated := testEval(input)
+	closure, ok := evaluated.(*object.Closure)
+	if !ok {
+		t.Fatalf("object is not Closure. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if closure.Fn.NumParameters != 1 {
+		t.Fatalf("function has wrong parameters. NumParameters=%d", closure.Fn.NumParameters)
+	}
+
+	expected := "fun (x) {\n(x + 2)\n}"
+	if closure.Inspect() != expected {
+		t.Fatalf("function is not %q. got=%q", expected, closure.Inspect())
+	}
+}
+
+func BenchmarkFib(b *testing.B) {
+	input := `
+var fib = fun (n) {
+if (n <=1) {
+return n;
+}
+return fib(n-1) + fib(n-2);
+}
+
+fib(20)
+`
+	comp := compiler.New()
+	if err := comp.Compile(parse(input)); err != nil {
+		b.Fatalf("compiler error: %s", err)
+	}
+	bytecode := comp.Bytecode()
+
+	for i := 0; i < b.N; i++ {
+		New(bytecode).Run()
+	}
+}
+
+func parse(input string) *ast.Program {
+	lxr := lexer.New(input)
+	parsr := parser.New(lxr)
+	return parsr.ParseProgram()
+}
+
+func testEval(input string) object.Object {
+	comp := compiler.New()
+	if err := comp.Compile(parse(input)); err != nil {
+		return &object.Error{Message: err.Error()}
+	}
+	return New(comp.Bytecode()).Run()
+}